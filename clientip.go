@@ -0,0 +1,170 @@
+package yogin
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+)
+
+// defaultRemoteIPHeaders are the RemoteIPHeaders of New.
+var defaultRemoteIPHeaders = []string{"X-Forwarded-For", "X-Real-IP"}
+
+// SetTrustedProxies sets the proxies trusted to report the client IP in the RemoteIPHeaders,
+// as IPs or CIDRs such as 10.0.0.0/8. The special value unix trusts the peers of Unix
+// sockets, e.g. nginx in front of RunUnix. By default no proxy is trusted, and the
+// ClientIP is the IP of the peer of the connection, see Context.RemoteIP.
+//     router.SetTrustedProxies([]string{"10.0.0.0/8", "192.168.1.2", "unix"})
+func (engine *Engine) SetTrustedProxies(trustedProxies []string) error {
+	trusted, err := parseTrustedNets(trustedProxies)
+	if err != nil {
+		return fmt.Errorf("invalid trusted proxy %v", err)
+	}
+	engine.trustedProxies = trusted
+	return nil
+}
+
+// trustedNets are the peers trusted by SetTrustedProxies or UseProxyProtocol.
+type trustedNets struct {
+	cidrs []*net.IPNet
+	unix  bool // the peers of Unix sockets
+}
+
+// parseTrustedNets parses a list of IPs and CIDRs. Its errors start with the invalid
+// entry, for the callers to tell which setting it belongs to.
+func parseTrustedNets(list []string) (trustedNets, error) {
+	var trusted trustedNets
+	for _, entry := range list {
+		entry = strings.TrimSpace(entry)
+		if entry == "unix" {
+			trusted.unix = true
+			continue
+		}
+		if !strings.Contains(entry, "/") {
+			ip := net.ParseIP(entry)
+			if ip == nil {
+				return trustedNets{}, fmt.Errorf("%q", entry)
+			}
+			bits := 8 * net.IPv6len
+			if ip4 := ip.To4(); ip4 != nil {
+				ip, bits = ip4, 8*net.IPv4len
+			}
+			trusted.cidrs = append(trusted.cidrs, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+		_, cidr, err := net.ParseCIDR(entry)
+		if err != nil {
+			return trustedNets{}, fmt.Errorf("%q: %v", entry, err)
+		}
+		trusted.cidrs = append(trusted.cidrs, cidr)
+	}
+	return trusted, nil
+}
+
+// contains reports whether ip is trusted, ip being empty for the peers of Unix sockets.
+func (trusted trustedNets) contains(ip string) bool {
+	if ip == "" {
+		return trusted.unix
+	}
+	if len(trusted.cidrs) == 0 {
+		return false
+	}
+	parsed := net.ParseIP(ip)
+	if parsed == nil {
+		return false
+	}
+	for _, cidr := range trusted.cidrs {
+		if cidr.Contains(parsed) {
+			return true
+		}
+	}
+	return false
+}
+
+// remoteIP returns the IP of the peer of the connection of req, or an empty string if
+// it has none, e.g. for Unix sockets.
+func remoteIP(req *http.Request) string {
+	ip, _, err := net.SplitHostPort(strings.TrimSpace(req.RemoteAddr))
+	if err != nil {
+		return ""
+	}
+	return ip
+}
+
+// clientIP returns the IP of the client that sent req. If the peer is a trusted proxy,
+// the IP is looked up in the RemoteIPHeaders in order, walking the chain of proxies
+// from right to left: the first IP that is not a trusted proxy is the client one.
+func (engine *Engine) clientIP(req *http.Request) string {
+	ip := remoteIP(req)
+	if !engine.trustedProxies.contains(ip) {
+		return ip
+	}
+	for _, header := range engine.RemoteIPHeaders {
+		values := req.Header.Values(header)
+		if len(values) == 0 {
+			continue
+		}
+		var nodes []string
+		if http.CanonicalHeaderKey(header) == "Forwarded" {
+			nodes = parseForwarded(strings.Join(values, ","))
+		} else {
+			nodes = strings.Split(strings.Join(values, ","), ",")
+		}
+		if clientIP, ok := engine.walkProxies(nodes); ok {
+			return clientIP
+		}
+	}
+	return ip
+}
+
+// walkProxies returns the rightmost IP of nodes that is not a trusted proxy, or the
+// leftmost one if they all are. It fails if it meets a node that is not an IP.
+func (engine *Engine) walkProxies(nodes []string) (string, bool) {
+	for i := len(nodes) - 1; i >= 0; i-- {
+		ip, ok := parseNodeIP(nodes[i])
+		if !ok {
+			return "", false
+		}
+		if i == 0 || !engine.trustedProxies.contains(ip) {
+			return ip, true
+		}
+	}
+	return "", false
+}
+
+// parseForwarded returns the for= node of each element of the RFC 7239 Forwarded header,
+// e.g. for=192.0.2.60;proto=http, for="[2001:db8:cafe::17]:4711". Elements without one
+// get an empty node.
+func parseForwarded(value string) []string {
+	elements := strings.Split(value, ",")
+	nodes := make([]string, len(elements))
+	for i, element := range elements {
+		for _, pair := range strings.Split(element, ";") {
+			if eq := strings.IndexByte(pair, '='); eq >= 0 && strings.EqualFold(strings.TrimSpace(pair[:eq]), "for") {
+				nodes[i] = pair[eq+1:]
+			}
+		}
+	}
+	return nodes
+}
+
+// parseNodeIP returns the IP of a node of a forwarded chain, which may be quoted and
+// have a port, e.g. 192.0.2.60:8080 or "[2001:db8::1]:4711". Obfuscated and unknown
+// nodes are not IPs.
+func parseNodeIP(node string) (string, bool) {
+	node = strings.Trim(strings.TrimSpace(node), `"`)
+	if strings.HasPrefix(node, "[") {
+		end := strings.IndexByte(node, ']')
+		if end < 0 {
+			return "", false
+		}
+		node = node[1:end]
+	} else if strings.Count(node, ":") == 1 {
+		node = node[:strings.IndexByte(node, ':')]
+	}
+	ip := net.ParseIP(node)
+	if ip == nil {
+		return "", false
+	}
+	return ip.String(), true
+}
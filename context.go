@@ -4,7 +4,6 @@ import (
 	"encoding/json"
 	"fmt"
 	"math"
-	"net"
 	"net/http"
 	"strings"
 	"sync"
@@ -21,7 +20,7 @@ type Context struct {
 	// request info
 	Path 	 	string
 	Method   	string
-	ClientIP 	string
+	ClientIP 	string // see Engine.SetTrustedProxies
 
 	Params 		Params
 	FullPath 	string
@@ -42,17 +41,12 @@ type Context struct {
 }
 
 func (c *Context) reset(w http.ResponseWriter, req *http.Request) *Context {
-	ip, _, err := net.SplitHostPort(strings.TrimSpace(req.RemoteAddr))
-	if err != nil {
-		fmt.Printf("remote ip parse error: %v\n", err)
-	}
-
 	c.Writer = w
 	c.Request = req
 
 	c.Path = req.URL.Path
 	c.Method = req.Method
-	c.ClientIP = ip
+	c.ClientIP = c.engine.clientIP(req)
 
 	c.handlers = nil
 	c.index = -1
@@ -82,6 +76,13 @@ func (c *Context) Param(key string) string {
 	return c.Params.ByName(key)
 }
 
+// RemoteIP returns the IP of the peer of the connection, e.g. the last proxy, while
+// ClientIP is the IP of the client according to the trusted proxies, see
+// Engine.SetTrustedProxies. It is empty for the peers of Unix sockets.
+func (c *Context) RemoteIP() string {
+	return remoteIP(c.Request)
+}
+
 // Query returns the keyed url query value if it exists,
 // otherwise it returns an empty string `("")`.
 // It is shortcut for `c.Request.URL.Query().Get(key)`
@@ -204,6 +205,15 @@ func (c *Context) HTML(code int, name string, obj interface{}) {
 	c.WithHTML(name, obj)
 }
 
+// Redirect returns a HTTP redirect to the specific location.
+func (c *Context) Redirect(code int, location string) {
+	if (code < http.StatusMultipleChoices || code > http.StatusPermanentRedirect) && code != http.StatusCreated {
+		panic(fmt.Sprintf("Cannot redirect with status code %d", code))
+	}
+	c.statusCode = code
+	http.Redirect(c.Writer, c.Request, location, code)
+}
+
 // File writes the specified file into the body stream in an efficient way.
 func (c *Context) File(filepath string) {
 	http.ServeFile(c.Writer, c.Request, filepath)
@@ -0,0 +1,104 @@
+package yogin
+
+import (
+	"net"
+	"strings"
+)
+
+// hostRouter holds the routes of the requests whose Host matches pattern.
+type hostRouter struct {
+	host    string
+	pattern *segmentPattern
+	trees   methodTrees
+}
+
+// Host returns a RouterGroup whose routes only match requests for the given host.
+// The host may contain params like a path segment, e.g. api.example.com or
+// :tenant.example.com, whose values are available through c.Param("tenant").
+// The port of the request Host is ignored, as is a port given in host, e.g.
+// localhost:8080 matches localhost on any port. Requests for hosts that match no
+// Host are served by the routes registered on the engine itself.
+//     tenants := router.Host(":tenant.example.com")
+//     tenants.GET("/", func(c *yogin.Context) {
+//         c.String(http.StatusOK, "hello %s", c.Param("tenant"))
+//     })
+func (engine *Engine) Host(host string, handlers ...HandlerFunc) *RouterGroup {
+	assert1(host != "", "host can not be empty")
+	pattern := parseHost(stripPort(host))
+	host = pattern.String()
+
+	engine.updateRoutes(func(table *routeTable) {
+		for _, router := range table.hosts {
+			if router.host == host {
+				return
+			}
+		}
+		table.addHost(&hostRouter{host: host, pattern: pattern, trees: make(methodTrees)})
+	})
+
+	return &RouterGroup{
+		Handlers: engine.combineHandlers(handlers),
+		basePath: "/",
+		engine:   engine,
+		host:     host,
+	}
+}
+
+// addHost keeps the hosts ordered from the most specific pattern to the least, so that
+// e.g. api.example.com is tried before :tenant.example.com.
+func (table *routeTable) addHost(router *hostRouter) {
+	i := len(table.hosts)
+	for i > 0 && router.moreSpecific(table.hosts[i-1]) {
+		i--
+	}
+	table.hosts = append(table.hosts, nil)
+	copy(table.hosts[i+1:], table.hosts[i:])
+	table.hosts[i] = router
+}
+
+// moreSpecific puts hosts without params first, and then compares the patterns.
+func (router *hostRouter) moreSpecific(other *hostRouter) bool {
+	literal, otherLiteral := len(router.pattern.keys()) == 0, len(other.pattern.keys()) == 0
+	if literal != otherLiteral {
+		return literal
+	}
+	return router.pattern.moreSpecific(other.pattern)
+}
+
+// matchHost returns the hostRouter matching the request host, appending the host params
+// to params, or nil for the default host.
+func (table *routeTable) matchHost(host string, params *Params) *hostRouter {
+	if len(table.hosts) == 0 {
+		return nil
+	}
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	host = strings.ToLower(host)
+	for _, router := range table.hosts {
+		if router.pattern.match(host, params) {
+			return router
+		}
+	}
+	return nil
+}
+
+// parseHost parses the host pattern, whose string literals are lowercased like the
+// request hosts they are matched against. Param names and constraints keep their case.
+func parseHost(host string) *segmentPattern {
+	pattern := parsePattern(host, host)
+	for i := range pattern.parts {
+		pattern.parts[i].literal = strings.ToLower(pattern.parts[i].literal)
+	}
+	return pattern
+}
+
+// stripPort removes the numeric port of a host pattern, which would be taken for a
+// param otherwise, e.g. localhost:8080. Params such as :tenant.example.com are kept.
+func stripPort(host string) string {
+	h, port, err := net.SplitHostPort(host)
+	if err != nil || h == "" || port == "" || strings.Trim(port, "0123456789") != "" {
+		return host
+	}
+	return h
+}
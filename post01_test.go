@@ -8,6 +8,7 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"net/url"
+	"strings"
 	"testing"
 )
 
@@ -106,11 +107,12 @@ func TestRoutesConflict(t *testing.T) {
 	}
 	assert.Panics(t, t0)
 
+	// allow at most one *catchAll style segment at each position
 	t1 := func() {
 		r := New()
 		{
-			r.addRoute(http.MethodGet, "/:hello/:world", nil)
-			r.addRoute(http.MethodGet, "/:hello/*world", nil)
+			r.addRoute(http.MethodGet, "/hello/*world1", nil)
+			r.addRoute(http.MethodGet, "/hello/*world2", nil)
 		}
 	}
 	assert.Panics(t, t1)
@@ -119,8 +121,8 @@ func TestRoutesConflict(t *testing.T) {
 		r := New()
 		{
 			r.addRoute(http.MethodGet, "/:hello/*world", nil)
-			r.addRoute(http.MethodGet, "/:hello/:world", nil)
-
+			r.addRoute(http.MethodPost, "/:hello/*world", nil)
+			r.addRoute(http.MethodGet, "/:hello/*extra", nil)
 		}
 	}
 	assert.Panics(t, t2)
@@ -150,72 +152,144 @@ func TestRoutesConflict(t *testing.T) {
 	}
 	assert.Panics(t, t5)
 
+	// allow at most one :param style segment at each position
 	t6 := func() {
 		r := New()
 		{
-			r.addRoute(http.MethodGet, "/*hello", nil)
-			r.addRoute(http.MethodGet, "/:hello/*world", nil)
+			r.addRoute(http.MethodGet, "/:hello1/world1", nil)
+			r.addRoute(http.MethodGet, "/:hello2/world2", nil)
 		}
 	}
 	assert.Panics(t, t6)
+}
 
-	t7 := func() {
+func TestRoutesNoConflict(t *testing.T) {
+	t0 := func() {
 		r := New()
 		{
-			r.addRoute(http.MethodGet, "/hello/*world", nil)
-			r.addRoute(http.MethodGet, "/*hello", nil)
+			r.addRoute(http.MethodGet, "/hello", nil)
+			r.addRoute(http.MethodGet, "/:hello", nil)
 		}
 	}
-	assert.Panics(t, t7)
+	assert.NotPanics(t, t0)
 
-	t8 := func() {
+	t1 := func() {
 		r := New()
 		{
 			r.addRoute(http.MethodGet, "/*hello", nil)
-			r.addRoute(http.MethodGet, "/:hello", nil)
+			r.addRoute(http.MethodPost, "/hello/*world", nil)
 		}
 	}
-	assert.Panics(t, t8)
+	assert.NotPanics(t, t1)
 
-	// allow at most one :param style segment at each position
-	t9 := func() {
+	t2 := func() {
 		r := New()
 		{
-			r.addRoute(http.MethodGet, "/:hello1/world1", nil)
-			r.addRoute(http.MethodGet, "/:hello2/world2", nil)
+			r.addRoute(http.MethodGet, "/hello/:world", nil)
+			r.addRoute(http.MethodGet, "/:hello/world", nil)
+			r.addRoute(http.MethodGet, "/:hello/:world", nil)
 		}
 	}
-	assert.Panics(t, t9)
-}
+	assert.NotPanics(t, t2)
 
-func TestRoutesNoConflict(t *testing.T) {
-	t0 := func() {
+	// *catchAll acts as the fallback of string literal and :param segments
+	t3 := func() {
 		r := New()
 		{
-			r.addRoute(http.MethodGet, "/hello", nil)
+			r.addRoute(http.MethodGet, "/:hello/:world", nil)
+			r.addRoute(http.MethodGet, "/:hello/*world", nil)
+		}
+	}
+	assert.NotPanics(t, t3)
+
+	t4 := func() {
+		r := New()
+		{
+			r.addRoute(http.MethodGet, "/*hello", nil)
+			r.addRoute(http.MethodGet, "/:hello/*world", nil)
 			r.addRoute(http.MethodGet, "/:hello", nil)
 		}
 	}
-	assert.NotPanics(t, t0)
+	assert.NotPanics(t, t4)
 
-	t1 := func() {
+	t5 := func() {
 		r := New()
 		{
+			r.addRoute(http.MethodGet, "/hello/*world", nil)
 			r.addRoute(http.MethodGet, "/*hello", nil)
-			r.addRoute(http.MethodPost, "/hello/*world", nil)
 		}
 	}
-	assert.NotPanics(t, t1)
+	assert.NotPanics(t, t5)
 
-	t2 := func() {
+	t6 := func() {
 		r := New()
 		{
-			r.addRoute(http.MethodGet, "/hello/:world", nil)
-			r.addRoute(http.MethodGet, "/:hello/world", nil)
-			r.addRoute(http.MethodGet, "/:hello/:world", nil)
+			r.addRoute(http.MethodGet, "/assets/manifest.json", nil)
+			r.addRoute(http.MethodGet, "/assets/*filepath", nil)
+			r.addRoute(http.MethodGet, "/assets/img/logo.png", nil)
 		}
 	}
-	assert.NotPanics(t, t2)
+	assert.NotPanics(t, t6)
+}
+
+func TestRoutesCatchAllFallback(t *testing.T) {
+	r := New()
+	routes := []string{
+		"/assets/manifest.json",
+		"/assets/*filepath",
+		"/assets/img/:name",
+		"/users/:id",
+		"/*filepath",
+	}
+	for _, route := range routes {
+		r.addRoute(http.MethodGet, route, HandlersChain{func(c *Context) {
+			c.String(http.StatusOK, "%s %v", c.FullPath, c.Params)
+		}})
+	}
+
+	cases := []struct {
+		path     string
+		expected string
+	}{
+		{"/assets/manifest.json", "/assets/manifest.json []"},
+		{"/assets/css/main.css", "/assets/*filepath [{filepath css/main.css}]"},
+		{"/assets/img/logo.png", "/assets/img/:name [{name logo.png}]"},
+		{"/assets/img/icons/logo.png", "/assets/*filepath [{filepath img/icons/logo.png}]"},
+		{"/users/42", "/users/:id [{id 42}]"},
+		{"/users/42/profile", "/*filepath [{filepath users/42/profile}]"},
+		{"/index.html", "/*filepath [{filepath index.html}]"},
+		{"/", "/*filepath [{filepath }]"},
+		{"/assets/", "/assets/*filepath [{filepath }]"},
+	}
+	for _, tc := range cases {
+		req := httptest.NewRequest(http.MethodGet, tc.path, nil)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusOK, w.Code, tc.path)
+		assert.Equal(t, tc.expected, w.Body.String(), tc.path)
+	}
+
+	// the fixed path of an empty remainder is redirected to the catch-all too
+	r = New()
+	r.RedirectFixedPath = true
+	r.GET("/assets/*filepath", func(c *Context) {})
+	for path, location := range map[string]string{"/ASSETS": "/assets", "/Assets/": "/assets/", "/Assets/x": "/assets/x"} {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusMovedPermanently, w.Code, path)
+		assert.Equal(t, location, w.Header().Get("Location"), path)
+	}
+
+	// a static folder serves its root too
+	r = New()
+	r.Static("/", "./testdata/assets")
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), "favicon.ico")
 }
 
 func TestRoutesMore(t *testing.T) {
@@ -256,3 +330,838 @@ func TestRoutesMore(t *testing.T) {
 		assert.Equal(t, "/:hello/:world", w.Body.String())
 	}
 }
+
+func TestRoutesMethodNotAllowed(t *testing.T) {
+	r := New()
+	r.GET("/users", func(c *Context) { c.String(http.StatusOK, "get") })
+	r.PUT("/users", func(c *Context) { c.String(http.StatusOK, "put") })
+	r.DELETE("/users/:id", func(c *Context) { c.String(http.StatusOK, "delete") })
+	r.POST("/users/:id", func(c *Context) { c.String(http.StatusOK, "post") })
+
+	{
+		req := httptest.NewRequest(http.MethodPost, "/users", nil)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusMethodNotAllowed, w.Code)
+		assert.Equal(t, "GET, HEAD, OPTIONS, PUT", w.Header().Get("Allow"))
+	}
+
+	{
+		req := httptest.NewRequest(http.MethodGet, "/users/42", nil)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusMethodNotAllowed, w.Code)
+		assert.Equal(t, "DELETE, OPTIONS, POST", w.Header().Get("Allow"))
+	}
+
+	{
+		req := httptest.NewRequest(http.MethodPatch, "/articles", nil)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusNotFound, w.Code)
+		assert.Empty(t, w.Header().Get("Allow"))
+	}
+
+	r.HandleMethodNotAllowed = false
+	{
+		req := httptest.NewRequest(http.MethodPost, "/users", nil)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusNotFound, w.Code)
+		assert.Empty(t, w.Header().Get("Allow"))
+	}
+}
+
+func TestRoutesNoMethod(t *testing.T) {
+	r := New()
+	r.Use(func(c *Context) { c.Header("X-Middleware", "global") })
+	r.NoMethod(func(c *Context) {
+		c.JSON(http.StatusMethodNotAllowed, H{"allow": c.Writer.Header().Get("Allow")})
+	})
+	r.GET("/users", func(c *Context) { c.String(http.StatusOK, "get") })
+
+	req := httptest.NewRequest(http.MethodPost, "/users", nil)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusMethodNotAllowed, w.Code)
+	assert.Equal(t, "global", w.Header().Get("X-Middleware"))
+	assert.Equal(t, `{"allow":"GET, HEAD, OPTIONS"}`, w.Body.String())
+}
+
+func TestRoutesRedirect(t *testing.T) {
+	r := New()
+	r.GET("/users", func(c *Context) { c.String(http.StatusOK, c.FullPath) })
+	r.POST("/users/:id", func(c *Context) { c.String(http.StatusOK, c.FullPath) })
+	r.GET("/Articles/:title", func(c *Context) { c.String(http.StatusOK, c.FullPath) })
+	r.GET("/docs/", func(c *Context) { c.String(http.StatusOK, c.FullPath) })
+	r.Group("/api").GET("/", func(c *Context) { c.String(http.StatusOK, c.FullPath) })
+
+	serve := func(method, path string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, nil)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	// paths are matched leniently unless the redirects are enabled
+	assert.Equal(t, http.StatusOK, serve(http.MethodGet, "/users/").Code)
+	assert.Equal(t, http.StatusOK, serve(http.MethodGet, "//users").Code)
+	assert.Equal(t, http.StatusNotFound, serve(http.MethodGet, "/USERS").Code)
+
+	r.RedirectTrailingSlash = true
+	{
+		w := serve(http.MethodGet, "/users/?page=2")
+		assert.Equal(t, http.StatusMovedPermanently, w.Code)
+		assert.Equal(t, "/users?page=2", w.Header().Get("Location"))
+	}
+	{
+		w := serve(http.MethodPost, "/users/42/")
+		assert.Equal(t, http.StatusPermanentRedirect, w.Code)
+		assert.Equal(t, "/users/42", w.Header().Get("Location"))
+	}
+	{
+		w := serve(http.MethodGet, "/docs")
+		assert.Equal(t, http.StatusMovedPermanently, w.Code)
+		assert.Equal(t, "/docs/", w.Header().Get("Location"))
+	}
+	{
+		w := serve(http.MethodGet, "/api")
+		assert.Equal(t, http.StatusMovedPermanently, w.Code)
+		assert.Equal(t, "/api/", w.Header().Get("Location"))
+	}
+	assert.Equal(t, "/docs/", serve(http.MethodGet, "/docs/").Body.String())
+	assert.Equal(t, "/api/", serve(http.MethodGet, "/api/").Body.String())
+	assert.Equal(t, http.StatusOK, serve(http.MethodGet, "/users").Code)
+	assert.Equal(t, http.StatusOK, serve(http.MethodGet, "//users").Code)
+
+	r.RedirectTrailingSlash = false
+	r.RedirectFixedPath = true
+	{
+		w := serve(http.MethodGet, "//users")
+		assert.Equal(t, http.StatusMovedPermanently, w.Code)
+		assert.Equal(t, "/users", w.Header().Get("Location"))
+	}
+	{
+		w := serve(http.MethodGet, "/USERS")
+		assert.Equal(t, http.StatusMovedPermanently, w.Code)
+		assert.Equal(t, "/users", w.Header().Get("Location"))
+	}
+	{
+		// param values keep their case
+		w := serve(http.MethodGet, "/blog/../articles/Hello-World")
+		assert.Equal(t, http.StatusMovedPermanently, w.Code)
+		assert.Equal(t, "/Articles/Hello-World", w.Header().Get("Location"))
+	}
+	{
+		w := serve(http.MethodPost, "/Users//42")
+		assert.Equal(t, http.StatusPermanentRedirect, w.Code)
+		assert.Equal(t, "/users/42", w.Header().Get("Location"))
+	}
+	assert.Equal(t, http.StatusOK, serve(http.MethodGet, "/users/").Code)
+	assert.Equal(t, http.StatusNotFound, serve(http.MethodGet, "/accounts").Code)
+
+	// the location is escaped, so that the segments can not leave the path
+	r.RedirectTrailingSlash = true
+	r.GET("/:name", func(c *Context) { c.String(http.StatusOK, c.Param("name")) })
+	for path, location := range map[string]string{
+		"/%5Cevil.com/":          "/%5Cevil.com",
+		"/Articles/x%3Fy/":       "/Articles/x%3Fy",
+		"/ARTICLES/x%3Fy":        "/Articles/x%3Fy",
+		"/ARTICLES/100%25":       "/Articles/100%25",
+		"/ARTICLES/a%20b?page=2": "/Articles/a%20b?page=2",
+	} {
+		w := serve(http.MethodGet, path)
+		assert.Equal(t, http.StatusMovedPermanently, w.Code, path)
+		assert.Equal(t, location, w.Header().Get("Location"), path)
+	}
+
+	// the raw path is already escaped
+	r.UseRawPath = true
+	{
+		w := serve(http.MethodGet, "/ARTICLES/x%3Fy")
+		assert.Equal(t, http.StatusMovedPermanently, w.Code)
+		assert.Equal(t, "/Articles/x%3Fy", w.Header().Get("Location"))
+	}
+}
+
+func TestRoutesBacktracking(t *testing.T) {
+	r := New()
+	routes := []string{
+		"/users/new/edit",
+		"/users/:id/profile",
+		"/users/:id",
+		"/hello/:world",
+		"/:hello/world",
+		"/hello/world/x",
+		"/:hello/world/y",
+		"/:hello/:world/more",
+	}
+	for _, route := range routes {
+		r.addRoute(http.MethodGet, route, HandlersChain{func(c *Context) {
+			c.String(http.StatusOK, "%s %v", c.FullPath, c.Params)
+		}})
+	}
+
+	cases := []struct {
+		path     string
+		expected string
+	}{
+		{"/users/new/edit", "/users/new/edit []"},
+		{"/users/new/profile", "/users/:id/profile [{id new}]"},
+		{"/users/new", "/users/:id [{id new}]"},
+		{"/users/42/profile", "/users/:id/profile [{id 42}]"},
+		{"/hello/world", "/hello/:world [{world world}]"},
+		{"/hi/world", "/:hello/world [{hello hi}]"},
+		{"/hello/world/x", "/hello/world/x []"},
+		{"/hello/world/y", "/:hello/world/y [{hello hello}]"},
+		{"/hello/there/more", "/:hello/:world/more [{hello hello} {world there}]"},
+	}
+	for _, tc := range cases {
+		req := httptest.NewRequest(http.MethodGet, tc.path, nil)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusOK, w.Code, tc.path)
+		assert.Equal(t, tc.expected, w.Body.String(), tc.path)
+	}
+
+	{
+		req := httptest.NewRequest(http.MethodGet, "/users/new/profile/more", nil)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusNotFound, w.Code)
+	}
+}
+
+type mockWriter struct {
+	headers http.Header
+}
+
+func newMockWriter() *mockWriter {
+	return &mockWriter{http.Header{}}
+}
+
+func (m *mockWriter) Header() (h http.Header) {
+	return m.headers
+}
+
+func (m *mockWriter) Write(p []byte) (n int, err error) {
+	return len(p), nil
+}
+
+func (m *mockWriter) WriteHeader(int) {}
+
+func TestRoutesZeroAllocs(t *testing.T) {
+	r := New()
+	r.GET("/", func(c *Context) {})
+	r.GET("/users/:id/profile", func(c *Context) {})
+	r.GET("/assets/*filepath", func(c *Context) {})
+
+	paths := []string{"/", "/users/42/profile", "/assets/css/main.css"}
+	for _, path := range paths {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		w := newMockWriter()
+		allocs := testing.AllocsPerRun(100, func() {
+			r.ServeHTTP(w, req)
+		})
+		assert.Zero(t, allocs, path)
+	}
+}
+
+func TestRoutesParamsPooled(t *testing.T) {
+	r := New()
+	r.GET("/:a/:b/:c/:d/:e/:f", func(c *Context) {
+		assert.Equal(t, "6", c.Param("f"))
+		assert.Len(t, c.Params, 6)
+	})
+	r.GET("/users/:id", func(c *Context) {
+		assert.Equal(t, Params{{"id", "42"}}, c.Params)
+	})
+
+	for i := 0; i < 3; i++ {
+		r.ServeHTTP(newMockWriter(), httptest.NewRequest(http.MethodGet, "/1/2/3/4/5/6", nil))
+		r.ServeHTTP(newMockWriter(), httptest.NewRequest(http.MethodGet, "/users/42", nil))
+	}
+}
+
+var benchmarkRoutes = []string{
+	"/",
+	"/users",
+	"/users/profile",
+	"/users/settings/notifications",
+	"/articles",
+	"/articles/latest",
+	"/assets/css/main.css",
+}
+
+func benchmarkRequest(b *testing.B, handler http.Handler, path string) {
+	req := httptest.NewRequest(http.MethodGet, path, nil)
+	w := newMockWriter()
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		handler.ServeHTTP(w, req)
+	}
+}
+
+func BenchmarkYoginStatic(b *testing.B) {
+	r := New()
+	for _, route := range benchmarkRoutes {
+		r.GET(route, func(c *Context) {})
+	}
+	benchmarkRequest(b, r, "/users/settings/notifications")
+}
+
+func BenchmarkServeMuxStatic(b *testing.B) {
+	mux := http.NewServeMux()
+	for _, route := range benchmarkRoutes {
+		mux.HandleFunc(route, func(w http.ResponseWriter, r *http.Request) {})
+	}
+	benchmarkRequest(b, mux, "/users/settings/notifications")
+}
+
+func BenchmarkYoginParam(b *testing.B) {
+	r := New()
+	for _, route := range benchmarkRoutes {
+		r.GET(route, func(c *Context) {})
+	}
+	r.GET("/users/:id/posts/:post", func(c *Context) {})
+	benchmarkRequest(b, r, "/users/42/posts/7")
+}
+
+// ServeMux has no params, the closest is a subtree pattern whose handler splits the path.
+func BenchmarkServeMuxParam(b *testing.B) {
+	mux := http.NewServeMux()
+	for _, route := range benchmarkRoutes {
+		mux.HandleFunc(route, func(w http.ResponseWriter, r *http.Request) {})
+	}
+	mux.HandleFunc("/users/", func(w http.ResponseWriter, r *http.Request) {})
+	benchmarkRequest(b, mux, "/users/42/posts/7")
+}
+
+func BenchmarkYoginCatchAll(b *testing.B) {
+	r := New()
+	for _, route := range benchmarkRoutes {
+		r.GET(route, func(c *Context) {})
+	}
+	r.GET("/static/*filepath", func(c *Context) {})
+	benchmarkRequest(b, r, "/static/js/vendor/app.js")
+}
+
+func handlerTest1(c *Context) {}
+func handlerTest2(c *Context) {}
+
+func TestRoutesInfo(t *testing.T) {
+	r := New()
+	r.Use(func(c *Context) {})
+	r.GET("/", handlerTest1)
+	r.GET("/users/:id", handlerTest1)
+	r.GET("/users/new", handlerTest2)
+	r.GET("/assets/*filepath", handlerTest2)
+	r.POST("/users", handlerTest2)
+
+	admin := r.Group("/admin", BasicAuth(Accounts{"admin": "password"}))
+	admin.DELETE("/users/:id", handlerTest1)
+
+	routes := r.Routes()
+	assert.Len(t, routes, 6)
+
+	expected := []struct {
+		method      string
+		path        string
+		handler     string
+		middlewares int
+	}{
+		{http.MethodDelete, "/admin/users/:id", "yogin.handlerTest1", 2},
+		{http.MethodGet, "/", "yogin.handlerTest1", 1},
+		{http.MethodGet, "/users/new", "yogin.handlerTest2", 1},
+		{http.MethodGet, "/users/:id", "yogin.handlerTest1", 1},
+		{http.MethodGet, "/assets/*filepath", "yogin.handlerTest2", 1},
+		{http.MethodPost, "/users", "yogin.handlerTest2", 1},
+	}
+	for i, route := range routes {
+		assert.Equal(t, expected[i].method, route.Method)
+		assert.Equal(t, expected[i].path, route.Path)
+		assert.Equal(t, expected[i].handler, route.Handler)
+		assert.Equal(t, expected[i].middlewares, route.Middlewares)
+		assert.NotNil(t, route.HandlerFunc)
+	}
+}
+
+func TestRoutesParamConstraints(t *testing.T) {
+	r := New()
+	routes := []string{
+		"/users/:id<int>",
+		"/users/:slug<[a-z-]+>",
+		"/users/:uuid<uuid>/profile",
+		"/users/:name",
+		"/users/me",
+		"/posts/:id<int>",
+	}
+	for _, route := range routes {
+		r.addRoute(http.MethodGet, route, HandlersChain{func(c *Context) {
+			c.String(http.StatusOK, "%s %v", c.FullPath, c.Params)
+		}})
+	}
+
+	cases := []struct {
+		path     string
+		expected string
+	}{
+		{"/users/42", "/users/:id<int> [{id 42}]"},
+		{"/users/jack-and-rose", "/users/:slug<[a-z-]+> [{slug jack-and-rose}]"},
+		{"/users/me", "/users/me []"},
+		{"/users/Jack42", "/users/:name [{name Jack42}]"},
+		{"/users/3f2504e0-4f89-11d3-9a0c-0305e82c3301/profile", "/users/:uuid<uuid>/profile [{uuid 3f2504e0-4f89-11d3-9a0c-0305e82c3301}]"},
+		{"/posts/7", "/posts/:id<int> [{id 7}]"},
+	}
+	for _, tc := range cases {
+		req := httptest.NewRequest(http.MethodGet, tc.path, nil)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusOK, w.Code, tc.path)
+		assert.Equal(t, tc.expected, w.Body.String(), tc.path)
+	}
+
+	for _, path := range []string{"/posts/abc", "/users/42/profile", "/users/not-a-uuid/profile"} {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusNotFound, w.Code, path)
+	}
+
+	assert.Panics(t, func() {
+		r.addRoute(http.MethodGet, "/posts/:num<int>", nil)
+	})
+	assert.Panics(t, func() {
+		r.addRoute(http.MethodGet, "/posts/:id<[a-z>", nil)
+	})
+	assert.NotPanics(t, func() {
+		r.addRoute(http.MethodGet, "/posts/:id<int>/comments", nil)
+		r.addRoute(http.MethodGet, "/posts/:id<uuid>", nil)
+	})
+}
+
+func TestRoutesMidSegmentParams(t *testing.T) {
+	r := New()
+	routes := []string{
+		"/files/:name.:ext",
+		"/files/:name",
+		"/files/:id<int>.json",
+		"/v:version/items",
+		"/v:version<int>/users",
+		"/@:user",
+		"/@:user/:repo-:branch",
+	}
+	for _, route := range routes {
+		r.addRoute(http.MethodGet, route, HandlersChain{func(c *Context) {
+			c.String(http.StatusOK, "%s %v", c.FullPath, c.Params)
+		}})
+	}
+
+	cases := []struct {
+		path     string
+		expected string
+	}{
+		{"/files/report.pdf", "/files/:name.:ext [{name report} {ext pdf}]"},
+		{"/files/archive.tar.gz", "/files/:name.:ext [{name archive} {ext tar.gz}]"},
+		{"/files/42.json", "/files/:id<int>.json [{id 42}]"},
+		{"/files/a.42.json", "/files/:name.:ext [{name a} {ext 42.json}]"},
+		{"/files/README", "/files/:name [{name README}]"},
+		{"/files/.bashrc", "/files/:name [{name .bashrc}]"},
+		{"/v2/items", "/v:version/items [{version 2}]"},
+		{"/v2/users", "/v:version<int>/users [{version 2}]"},
+		{"/@jack", "/@:user [{user jack}]"},
+		{"/@jack/yogin-main", "/@:user/:repo-:branch [{user jack} {repo yogin} {branch main}]"},
+	}
+	for _, tc := range cases {
+		req := httptest.NewRequest(http.MethodGet, tc.path, nil)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusOK, w.Code, tc.path)
+		assert.Equal(t, tc.expected, w.Body.String(), tc.path)
+	}
+
+	for _, path := range []string{"/vx/users", "/v/items", "/@", "/@jack/yogin"} {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusNotFound, w.Code, path)
+	}
+
+	assert.Panics(t, func() {
+		r.addRoute(http.MethodGet, "/files/:base.:extension", nil)
+	})
+	assert.Panics(t, func() {
+		r.addRoute(http.MethodGet, "/files/:name:ext", nil)
+	})
+	assert.Panics(t, func() {
+		r.addRoute(http.MethodGet, "/files/x:", nil)
+	})
+	assert.Panics(t, func() {
+		r.addRoute(http.MethodGet, "/files/:id<int", nil)
+	})
+}
+
+func TestRoutesOptionalParams(t *testing.T) {
+	r := New()
+	r.GET("/posts/:page?", func(c *Context) {
+		page, ok := c.Params.Get("page")
+		c.String(http.StatusOK, "%s %s %v", c.FullPath, page, ok)
+	})
+	r.GET("/archive/:year<int>=2021/:month=1", func(c *Context) {
+		c.String(http.StatusOK, "%s %s-%s", c.FullPath, c.Param("year"), c.Param("month"))
+	}).Name("archive")
+
+	cases := []struct {
+		path     string
+		expected string
+	}{
+		{"/posts", "/posts/:page?  false"},
+		{"/posts/3", "/posts/:page? 3 true"},
+		{"/archive", "/archive/:year<int>=2021/:month=1 2021-1"},
+		{"/archive/2020", "/archive/:year<int>=2021/:month=1 2020-1"},
+		{"/archive/2020/12", "/archive/:year<int>=2021/:month=1 2020-12"},
+	}
+	for _, tc := range cases {
+		req := httptest.NewRequest(http.MethodGet, tc.path, nil)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusOK, w.Code, tc.path)
+		assert.Equal(t, tc.expected, w.Body.String(), tc.path)
+	}
+
+	{
+		req := httptest.NewRequest(http.MethodGet, "/archive/latest", nil)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusNotFound, w.Code)
+	}
+
+	location, err := r.URL("archive", "year", 2020)
+	assert.NoError(t, err)
+	assert.Equal(t, "/archive/2020", location)
+	location, err = r.URL("archive")
+	assert.NoError(t, err)
+	assert.Equal(t, "/archive", location)
+	_, err = r.URL("archive", "month", 12)
+	assert.Error(t, err)
+
+	routes := r.Routes()
+	assert.Len(t, routes, 2)
+
+	// optional params shadowing existing routes
+	assert.Panics(t, func() {
+		r.GET("/posts", func(c *Context) {})
+	})
+	assert.Panics(t, func() {
+		r := New()
+		r.GET("/users", func(c *Context) {})
+		r.GET("/users/:id?", func(c *Context) {})
+	})
+	assert.Panics(t, func() {
+		r := New()
+		r.GET("/users/:id", func(c *Context) {})
+		r.GET("/users/:id=1", func(c *Context) {})
+	})
+	assert.Panics(t, func() {
+		r := New()
+		r.GET("/users/:id?/posts", func(c *Context) {})
+	})
+	assert.Panics(t, func() {
+		r := New()
+		r.GET("/users/:id<int>=me", func(c *Context) {})
+	})
+}
+
+func TestRoutesAutomaticOPTIONS(t *testing.T) {
+	r := New()
+	r.Use(func(c *Context) { c.Header("Access-Control-Allow-Origin", "*") })
+	r.GET("/users", func(c *Context) { c.String(http.StatusOK, "users") })
+	r.POST("/users", func(c *Context) { c.String(http.StatusCreated, "created") })
+	r.DELETE("/users/:id", func(c *Context) {})
+	r.OPTIONS("/custom", func(c *Context) { c.String(http.StatusOK, "custom") })
+
+	cases := []struct {
+		path  string
+		allow string
+	}{
+		{"/users", "GET, HEAD, OPTIONS, POST"},
+		{"/users/42", "DELETE, OPTIONS"},
+		{"*", "DELETE, GET, HEAD, OPTIONS, POST"},
+	}
+	for _, tc := range cases {
+		req := httptest.NewRequest(http.MethodOptions, "/", nil)
+		req.URL.Path = tc.path
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusNoContent, w.Code, tc.path)
+		assert.Equal(t, tc.allow, w.Header().Get("Allow"), tc.path)
+		assert.Equal(t, "*", w.Header().Get("Access-Control-Allow-Origin"), tc.path)
+		assert.Empty(t, w.Body.String())
+	}
+
+	{
+		req := httptest.NewRequest(http.MethodOptions, "/custom", nil)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, "custom", w.Body.String())
+	}
+
+	{
+		req := httptest.NewRequest(http.MethodOptions, "/missing", nil)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusNotFound, w.Code)
+	}
+
+	r.HandleOPTIONS = false
+	{
+		req := httptest.NewRequest(http.MethodOptions, "/users", nil)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusMethodNotAllowed, w.Code)
+		assert.Equal(t, "GET, HEAD, POST", w.Header().Get("Allow"))
+	}
+}
+
+func TestRoutesHEADFallback(t *testing.T) {
+	r := New()
+	r.GET("/users/:id", func(c *Context) {
+		c.Header("X-User", c.Param("id"))
+		c.JSON(http.StatusOK, H{"id": c.Param("id")})
+	})
+	r.GET("/empty", func(c *Context) {})
+	r.GET("/events", func(c *Context) {
+		c.Header("Content-Type", "text/event-stream")
+		for i := 0; i < 2; i++ {
+			fmt.Fprintf(c.Writer, "data: %d\n\n", i)
+			c.Writer.(http.Flusher).Flush()
+		}
+		_, _, err := c.Writer.(http.Hijacker).Hijack()
+		assert.Error(t, err)
+	})
+	r.GET("/moved", func(c *Context) { c.Redirect(http.StatusFound, "/users/1") })
+	r.HEAD("/custom", func(c *Context) { c.Header("X-Custom", "head") })
+	r.GET("/custom", func(c *Context) { c.String(http.StatusOK, "get") })
+
+	{
+		req := httptest.NewRequest(http.MethodHead, "/users/42", nil)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, "42", w.Header().Get("X-User"))
+		assert.Equal(t, "application/json; charset=utf-8", w.Header().Get("Content-Type"))
+		assert.Equal(t, "11", w.Header().Get("Content-Length"))
+		assert.Empty(t, w.Body.String())
+	}
+
+	{
+		req := httptest.NewRequest(http.MethodHead, "/empty", nil)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, "0", w.Header().Get("Content-Length"))
+	}
+
+	{
+		// streaming handlers can flush, the headers are only written once they return
+		req := httptest.NewRequest(http.MethodHead, "/events", nil)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, "text/event-stream", w.Header().Get("Content-Type"))
+		assert.Equal(t, "18", w.Header().Get("Content-Length"))
+		assert.False(t, w.Flushed)
+		assert.Empty(t, w.Body.String())
+	}
+
+	{
+		req := httptest.NewRequest(http.MethodHead, "/moved", nil)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusFound, w.Code)
+		assert.Equal(t, "/users/1", w.Header().Get("Location"))
+		assert.Empty(t, w.Body.String())
+	}
+
+	{
+		req := httptest.NewRequest(http.MethodHead, "/custom", nil)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, "head", w.Header().Get("X-Custom"))
+	}
+
+	{
+		req := httptest.NewRequest(http.MethodHead, "/missing", nil)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusNotFound, w.Code)
+	}
+}
+
+func TestRoutesRawPath(t *testing.T) {
+	newRouter := func(useRawPath, unescape bool) *Engine {
+		r := New()
+		r.UseRawPath = useRawPath
+		r.UnescapePathValues = unescape
+		r.GET("/files/:name", func(c *Context) { c.String(http.StatusOK, "file %s", c.Param("name")) })
+		r.GET("/files/:name/:file", func(c *Context) {
+			c.String(http.StatusOK, "dir %s file %s", c.Param("name"), c.Param("file"))
+		})
+		r.GET("/static/*filepath", func(c *Context) { c.String(http.StatusOK, "static %s", c.Param("filepath")) })
+		r.Mount("/legacy", http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			w.Write([]byte("legacy " + req.URL.Path + " " + req.URL.EscapedPath()))
+		}))
+		return r
+	}
+
+	cases := []struct {
+		useRawPath bool
+		unescape   bool
+		path       string
+		expected   string
+	}{
+		{false, true, "/files/a%2Fb", "dir a file b"},
+		{false, false, "/files/a%20b", "file a b"},
+		{true, true, "/files/a%2Fb", "file a/b"},
+		{true, true, "/files/a%2Fb%20c", "file a/b c"},
+		{true, true, "/files/a%20b", "file a b"},
+		{true, false, "/files/a%2Fb", "file a%2Fb"},
+		{true, true, "/static/a%2Fb/c", "static a/b/c"},
+		{true, false, "/static/a%2Fb/c", "static a%2Fb/c"},
+		{true, true, "/legacy/a%2Fb/", "legacy /a/b/ /a%2Fb/"},
+	}
+	for _, tc := range cases {
+		r := newRouter(tc.useRawPath, tc.unescape)
+		req := httptest.NewRequest(http.MethodGet, tc.path, nil)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusOK, w.Code, tc.path)
+		assert.Equal(t, tc.expected, w.Body.String(), tc.path)
+	}
+}
+
+func TestRoutesPrintTree(t *testing.T) {
+	r := New()
+	r.GET("/", func(c *Context) {})
+	r.GET("/users/new", func(c *Context) {})
+	r.GET("/users/:id<int>", func(c *Context) {}, func(c *Context) {})
+	r.GET("/assets/*filepath", func(c *Context) {})
+	r.POST("/users", func(c *Context) {})
+	r.Host(":tenant.example.com").GET("/", func(c *Context) {})
+
+	var b strings.Builder
+	r.PrintTree(&b)
+	assert.Equal(t, `GET
+/  handlers=1  /
+  users  wildChild
+    new  handlers=1  /users/new
+    :id<int>  handlers=2  /users/:id<int>
+  assets  wildChild
+    *filepath  handlers=1  /assets/*filepath
+POST
+/
+  users  handlers=1  /users
+GET :tenant.example.com
+/  handlers=1  /
+`, b.String())
+
+	b.Reset()
+	r.PrintDOT(&b)
+	dot := b.String()
+	assert.True(t, strings.HasPrefix(dot, "digraph routes {\n"))
+	assert.Contains(t, dot, "\t\tlabel=\"GET :tenant.example.com\";\n")
+	assert.Contains(t, dot, "\t\tn3 [label=\":id<int>\\n/users/:id<int>\\n2 handlers\", peripheries=2, style=dashed];\n")
+	assert.Contains(t, dot, "\t\tn1 -> n3;\n")
+	assert.Equal(t, 3, strings.Count(dot, "subgraph cluster_"))
+
+	defer func() {
+		err := recover()
+		assert.NotNil(t, err)
+		assert.Contains(t, err, ":uid<int> in new path /users/:uid<int> conflicts with existing wildcard :id<int>")
+		assert.Contains(t, err, "\n\nGET\n/  handlers=1  /\n  users  wildChild\n")
+	}()
+	r.GET("/users/:uid<int>", func(c *Context) {})
+}
+
+func TestRoutesCaseInsensitive(t *testing.T) {
+	r := New()
+	r.CaseInsensitive = true
+	handler := func(c *Context) {
+		c.String(http.StatusOK, "%s %s", c.FullPath, c.Param("name"))
+	}
+	r.GET("/users/profile", handler)
+	r.GET("/users/:name", handler)
+	r.GET("/Files/:name", handler)
+	r.GET("/files/readme", handler)
+	r.GET("/Teams/a", handler)
+	r.GET("/teams/b", handler)
+
+	cases := []struct {
+		path     string
+		expected string
+	}{
+		{"/users/profile", "/users/profile "},
+		{"/Users/Profile", "/users/profile "},
+		{"/USERS/Jack", "/users/:name Jack"},
+		{"/files/readme", "/files/readme "},
+		{"/FILES/ReadMe", "/Files/:name ReadMe"},
+		{"/Files/readme", "/Files/:name readme"},
+		// siblings differing only in case are all tried
+		{"/teams/a", "/Teams/a "},
+		{"/TEAMS/b", "/teams/b "},
+		{"/Teams/b", "/teams/b "},
+	}
+	for _, tc := range cases {
+		req := httptest.NewRequest(http.MethodGet, tc.path, nil)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusOK, w.Code, tc.path)
+		assert.Equal(t, tc.expected, w.Body.String(), tc.path)
+	}
+
+	r.CaseInsensitive = false
+	req := httptest.NewRequest(http.MethodGet, "/Users/Profile", nil)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+
+	r = New()
+	r.CaseInsensitive = true
+	r.GET("/users/profile", func(c *Context) {})
+	for _, path := range []string{"/users/profile", "/Users/Profile"} {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		w := newMockWriter()
+		allocs := testing.AllocsPerRun(100, func() {
+			r.ServeHTTP(w, req)
+		})
+		assert.Zero(t, allocs, path)
+	}
+}
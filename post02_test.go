@@ -2,8 +2,11 @@ package yogin
 
 import (
 	"github.com/stretchr/testify/assert"
+	"html/template"
 	"net/http"
 	"net/http/httptest"
+	"strconv"
+	"sync"
 	"testing"
 )
 
@@ -78,3 +81,514 @@ func TestRouterGroupHandle(t *testing.T) {
 		}
 	}
 }
+
+func TestRouterGroupNoRoute(t *testing.T) {
+	r := New()
+	r.SetFuncMap(template.FuncMap{
+		"FormatAsDate": FormatAsDate,
+	})
+	r.LoadHTMLGlob("testdata/templates/*")
+	r.Use(func(c *Context) { c.Header("X-Middleware", "global") })
+	r.NoRoute(func(c *Context) {
+		c.HTML(http.StatusNotFound, "404.tmpl", H{"path": c.Path})
+	})
+
+	api := r.Group("/api", func(c *Context) { c.Header("X-Group", "api") })
+	api.NoRoute(func(c *Context) {
+		c.JSON(http.StatusNotFound, H{"error": "not found"})
+	})
+	api.GET("/users", func(c *Context) { c.String(http.StatusOK, "users") })
+
+	// the default message is used when the NoRoute handlers write nothing
+	web := r.Group("/web")
+	web.NoRoute(func(c *Context) { c.Header("X-Group", "web") })
+
+	{
+		req := httptest.NewRequest(http.MethodGet, "/missing", nil)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusNotFound, w.Code)
+		assert.Equal(t, "global", w.Header().Get("X-Middleware"))
+		assert.Contains(t, w.Body.String(), "<h1>Page /missing not found</h1>")
+	}
+
+	{
+		req := httptest.NewRequest(http.MethodGet, "/api/articles", nil)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusNotFound, w.Code)
+		assert.Equal(t, "global", w.Header().Get("X-Middleware"))
+		assert.Equal(t, "api", w.Header().Get("X-Group"))
+		assert.Equal(t, `{"error":"not found"}`, w.Body.String())
+	}
+
+	{
+		req := httptest.NewRequest(http.MethodGet, "/apiv2", nil)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusNotFound, w.Code)
+		assert.Contains(t, w.Body.String(), "<h1>Page /apiv2 not found</h1>")
+	}
+
+	{
+		req := httptest.NewRequest(http.MethodGet, "/web/index", nil)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusNotFound, w.Code)
+		assert.Equal(t, "web", w.Header().Get("X-Group"))
+		assert.Equal(t, "url /web/index not found", w.Body.String())
+	}
+}
+
+func TestRouterGroupNamedRoutes(t *testing.T) {
+	r := New()
+	r.GET("/", func(c *Context) {}).Name("index")
+	api := r.Group("/api")
+	api.GET("/users/:id", func(c *Context) {}).Name("user")
+	api.PUT("/users/:id", func(c *Context) {}).Name("user")
+	api.GET("/users/:id/posts/:post", func(c *Context) {}).Name("post")
+	r.GET("/assets/*filepath", func(c *Context) {}).Name("asset")
+
+	assert.Panics(t, func() {
+		r.GET("/users/:id", func(c *Context) {}).Name("user")
+	})
+
+	cases := []struct {
+		name     string
+		params   []interface{}
+		expected string
+	}{
+		{"index", nil, "/"},
+		{"user", []interface{}{"id", 42}, "/api/users/42"},
+		{"user", []interface{}{"id", "a b/c"}, "/api/users/a%20b%2Fc"},
+		{"user", []interface{}{"id", 42, "tab", "posts"}, "/api/users/42?tab=posts"},
+		{"post", []interface{}{"post", 7, "id", 42}, "/api/users/42/posts/7"},
+		{"asset", []interface{}{"filepath", "css/main file.css"}, "/assets/css/main%20file.css"},
+	}
+	for _, tc := range cases {
+		location, err := r.URL(tc.name, tc.params...)
+		assert.NoError(t, err)
+		assert.Equal(t, tc.expected, location)
+	}
+
+	_, err := r.URL("missing")
+	assert.Error(t, err)
+	_, err = r.URL("user")
+	assert.Error(t, err)
+	_, err = r.URL("user", "id")
+	assert.Error(t, err)
+
+	r.GET("/posts/:id<int>", func(c *Context) {}).Name("typed")
+	location, err := r.URL("typed", "id", 7)
+	assert.NoError(t, err)
+	assert.Equal(t, "/posts/7", location)
+	_, err = r.URL("typed", "id", "abc")
+	assert.Error(t, err)
+}
+
+func TestRouterGroupURLForTemplate(t *testing.T) {
+	r := New()
+	r.SetFuncMap(template.FuncMap{
+		"FormatAsDate": FormatAsDate,
+	})
+	r.LoadHTMLGlob("testdata/templates/*")
+	r.GET("/users/:id", func(c *Context) {
+		c.HTML(http.StatusOK, "links.tmpl", H{"id": c.Param("id"), "name": "Jack"})
+	}).Name("user")
+
+	req := httptest.NewRequest(http.MethodGet, "/users/42", nil)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "<a href=\"/users/42\">Jack</a>\n", w.Body.String())
+}
+
+func TestRouterGroupHandleMethods(t *testing.T) {
+	r := New()
+	handler := func(c *Context) {
+		c.String(http.StatusOK, "%s %s", c.Method, c.FullPath)
+	}
+	dav := r.Group("/dav")
+	dav.Handle("PROPFIND", "/files/*filepath", handler)
+	dav.Handle("REPORT", "/calendars/:id", handler)
+	r.Handle("PURGE", "/cache/*key", handler)
+	route := r.Any("/ping", handler).Name("ping")
+	assert.Equal(t, anyMethods, route.Methods)
+	route = r.Match([]string{http.MethodGet, "SEARCH"}, "/search", handler)
+	assert.Equal(t, []string{http.MethodGet, "SEARCH"}, route.Methods)
+	assert.Equal(t, "/search", route.Path)
+
+	assert.Panics(t, func() { r.Handle("", "/invalid", handler) })
+	assert.Panics(t, func() { r.Handle("GET POST", "/invalid", handler) })
+	assert.Panics(t, func() { r.Handle("GET\n", "/invalid", handler) })
+	assert.Panics(t, func() { r.Match(nil, "/invalid", handler) })
+
+	cases := []struct {
+		method   string
+		path     string
+		expected string
+	}{
+		{"PROPFIND", "/dav/files/docs/a.txt", "PROPFIND /dav/files/*filepath"},
+		{"REPORT", "/dav/calendars/1", "REPORT /dav/calendars/:id"},
+		{"PURGE", "/cache/users/42", "PURGE /cache/*key"},
+		{"SEARCH", "/search", "SEARCH /search"},
+		{http.MethodGet, "/search", "GET /search"},
+	}
+	for _, method := range anyMethods {
+		cases = append(cases, struct {
+			method   string
+			path     string
+			expected string
+		}{method, "/ping", method + " /ping"})
+	}
+	for _, tc := range cases {
+		req := httptest.NewRequest(tc.method, tc.path, nil)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusOK, w.Code, tc.method+" "+tc.path)
+		if tc.method != http.MethodHead {
+			assert.Equal(t, tc.expected, w.Body.String())
+		}
+	}
+
+	{
+		req := httptest.NewRequest("PROPFIND", "/search", nil)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusMethodNotAllowed, w.Code)
+		assert.Equal(t, "GET, HEAD, OPTIONS, SEARCH", w.Header().Get("Allow"))
+	}
+}
+
+func TestRouterGroupHost(t *testing.T) {
+	r := New()
+	r.Use(func(c *Context) { c.Header("X-Middleware", "global") })
+	r.GET("/", func(c *Context) { c.String(http.StatusOK, "default") })
+
+	tenants := r.Host(":tenant.example.com", func(c *Context) { c.Header("X-Host", "tenant") })
+	tenants.GET("/", func(c *Context) { c.String(http.StatusOK, "tenant %s", c.Param("tenant")) })
+	tenants.GET("/users/:id", func(c *Context) {
+		c.String(http.StatusOK, "tenant %s user %s", c.Param("tenant"), c.Param("id"))
+	})
+	tenants.NoRoute(func(c *Context) { c.String(http.StatusNotFound, "no such page for %s", c.Param("tenant")) })
+
+	api := r.Host("api.example.com")
+	v1 := api.Group("/v1")
+	v1.GET("/users", func(c *Context) { c.String(http.StatusOK, "api users") })
+	r.Host("API.example.com").GET("/", func(c *Context) { c.String(http.StatusOK, "api") })
+	r.Host("localhost:8080").GET("/", func(c *Context) { c.String(http.StatusOK, "local") })
+	// only the string literals are lowercased
+	r.Host(":shopID<[a-z]+>.Shop.Example.com").GET("/", func(c *Context) { c.String(http.StatusOK, "shop %s", c.Param("shopID")) })
+
+	cases := []struct {
+		host     string
+		path     string
+		code     int
+		expected string
+	}{
+		{"example.com", "/", http.StatusOK, "default"},
+		{"acme.example.com", "/", http.StatusOK, "tenant acme"},
+		{"acme.example.com:8080", "/users/42", http.StatusOK, "tenant acme user 42"},
+		{"Acme.Example.com", "/", http.StatusOK, "tenant acme"},
+		{"acme.example.com", "/missing", http.StatusNotFound, "no such page for acme"},
+		{"api.example.com", "/v1/users", http.StatusOK, "api users"},
+		{"api.example.com", "/", http.StatusOK, "api"},
+		{"api.example.com", "/users/42", http.StatusNotFound, "url /users/42 not found"},
+		{"other.org", "/users/42", http.StatusNotFound, "url /users/42 not found"},
+		{"localhost:8080", "/", http.StatusOK, "local"},
+		{"localhost", "/", http.StatusOK, "local"},
+		{"Acme.shop.example.COM", "/", http.StatusOK, "shop acme"},
+	}
+	for _, tc := range cases {
+		req := httptest.NewRequest(http.MethodGet, tc.path, nil)
+		req.Host = tc.host
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+
+		assert.Equal(t, tc.code, w.Code, tc.host+tc.path)
+		assert.Equal(t, tc.expected, w.Body.String(), tc.host+tc.path)
+		assert.Equal(t, "global", w.Header().Get("X-Middleware"))
+	}
+
+	routes := r.Routes()
+	assert.Len(t, routes, 7)
+	assert.Equal(t, "", routes[0].Host)
+	assert.Equal(t, "api.example.com", routes[1].Host)
+	assert.Equal(t, "/", routes[1].Path)
+	assert.Equal(t, "api.example.com", routes[2].Host)
+	assert.Equal(t, "/v1/users", routes[2].Path)
+	assert.Equal(t, "localhost", routes[3].Host)
+	assert.Equal(t, ":shopID<[a-z]+>.shop.example.com", routes[4].Host)
+	assert.Equal(t, ":tenant.example.com", routes[5].Host)
+}
+
+func TestRouterGroupReplaceRemove(t *testing.T) {
+	r := New()
+	api := r.Group("/api")
+	api.GET("/users/:id", func(c *Context) { c.String(http.StatusOK, "v1 user %s", c.Param("id")) })
+	api.GET("/posts/:page=1", func(c *Context) { c.String(http.StatusOK, "page %s", c.Param("page")) })
+	api.POST("/posts", func(c *Context) { c.String(http.StatusCreated, "created") })
+
+	serve := func(method, path string) (int, string) {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(method, path, nil))
+		return w.Code, w.Body.String()
+	}
+
+	assert.Panics(t, func() { api.GET("/users/:id", func(c *Context) {}) })
+	api.Replace(http.MethodGet, "/users/:id", func(c *Context) { c.String(http.StatusOK, "v2 user %s", c.Param("id")) })
+	code, body := serve(http.MethodGet, "/api/users/42")
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, "v2 user 42", body)
+	assert.Panics(t, func() { api.Replace("BAD METHOD", "/users/:id", func(c *Context) {}) })
+
+	assert.True(t, api.Remove(http.MethodGet, "/posts/:page=1"))
+	assert.False(t, api.Remove(http.MethodGet, "/posts/:page=1"))
+	assert.False(t, api.Remove(http.MethodGet, "/posts/:page"))
+	code, _ = serve(http.MethodGet, "/api/posts/2")
+	assert.Equal(t, http.StatusNotFound, code)
+	code, _ = serve(http.MethodGet, "/api/posts")
+	assert.Equal(t, http.StatusMethodNotAllowed, code)
+	code, body = serve(http.MethodPost, "/api/posts")
+	assert.Equal(t, http.StatusCreated, code)
+	assert.Equal(t, "created", body)
+
+	// the pruned path can be registered again with another param name
+	api.GET("/posts/:slug", func(c *Context) { c.String(http.StatusOK, "post %s", c.Param("slug")) })
+	code, body = serve(http.MethodGet, "/api/posts/hello")
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, "post hello", body)
+
+	assert.True(t, api.Remove(http.MethodPost, "/posts"))
+	assert.Len(t, r.Routes(), 2)
+
+	// the names of a path are dropped once no method serves it
+	api.GET("/tags/:tag", func(c *Context) {}).Name("tag")
+	api.DELETE("/tags/:tag", func(c *Context) {})
+	assert.True(t, api.Remove(http.MethodGet, "/tags/:tag"))
+	url, err := r.URL("tag", "tag", "go")
+	assert.NoError(t, err)
+	assert.Equal(t, "/api/tags/go", url)
+	assert.True(t, api.Remove(http.MethodDelete, "/tags/:tag"))
+	_, err = r.URL("tag", "tag", "go")
+	assert.Error(t, err)
+	api.GET("/tags/:tag", func(c *Context) {}).Name("tag")
+	url, err = r.URL("tag", "tag", "go")
+	assert.NoError(t, err)
+	assert.Equal(t, "/api/tags/go", url)
+	assert.True(t, api.Remove(http.MethodGet, "/tags/:tag"))
+
+	// a failed registration leaves the routes unchanged
+	assert.Panics(t, func() { api.GET("/posts/:id", func(c *Context) {}) })
+	assert.Len(t, r.Routes(), 2)
+}
+
+func TestRouterGroupRuntimeRoutes(t *testing.T) {
+	r := New()
+	r.GET("/ping", func(c *Context) { c.String(http.StatusOK, "pong") })
+	tenants := r.Host(":tenant.example.com")
+
+	stop := make(chan struct{})
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-stop:
+					return
+				default:
+				}
+				w := httptest.NewRecorder()
+				r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/ping", nil))
+				assert.Equal(t, "pong", w.Body.String())
+
+				req := httptest.NewRequest(http.MethodGet, "/modules/7/items/3", nil)
+				req.Host = "acme.example.com"
+				w = httptest.NewRecorder()
+				r.ServeHTTP(w, req)
+				if w.Code == http.StatusOK {
+					assert.Equal(t, "acme 7 3", w.Body.String())
+				} else {
+					assert.Equal(t, http.StatusNotFound, w.Code)
+				}
+			}
+		}()
+	}
+
+	for i := 0; i < 100; i++ {
+		name := strconv.Itoa(i % 10)
+		module := tenants.Group("/modules/" + name)
+		item := func(c *Context) {
+			c.String(http.StatusOK, "%s %s %s", c.Param("tenant"), name, c.Param("id"))
+		}
+		module.GET("/items/:id", item)
+		module.Replace(http.MethodGet, "/items/:id", item)
+		r.GET("/modules/"+strconv.Itoa(i), func(c *Context) {}).Name("module" + strconv.Itoa(i))
+		assert.True(t, module.Remove(http.MethodGet, "/items/:id"))
+	}
+	close(stop)
+	wg.Wait()
+
+	url, err := r.URL("module99")
+	assert.NoError(t, err)
+	assert.Equal(t, "/modules/99", url)
+	assert.Len(t, r.Routes(), 101)
+}
+
+func TestRouterGroupMount(t *testing.T) {
+	r := New()
+	var status, size int
+	r.Use(func(c *Context) {
+		c.Next()
+		status, size = c.statusCode, c.bodySize
+	})
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", func(w http.ResponseWriter, req *http.Request) {
+		w.WriteHeader(http.StatusAccepted)
+		w.Write([]byte("legacy " + req.URL.Path))
+	})
+	r.Mount("/legacy", mux)
+	r.GET("/ping", WrapF(func(w http.ResponseWriter, req *http.Request) {
+		w.Write([]byte("pong"))
+	}))
+
+	admin := New()
+	admin.SetFuncMap(template.FuncMap{
+		"FormatAsDate": FormatAsDate,
+	})
+	admin.LoadHTMLGlob("testdata/templates/*")
+	admin.NoRoute(func(c *Context) {
+		c.HTML(http.StatusNotFound, "404.tmpl", H{"path": c.Path})
+	})
+	admin.GET("/", func(c *Context) { c.String(http.StatusOK, "admin home") })
+	admin.GET("/users/:id", func(c *Context) { c.String(http.StatusOK, "admin user %s", c.Param("id")) })
+	api := r.Group("/api", func(c *Context) { c.Header("X-Group", "api") })
+	api.Mount("/admin", admin)
+
+	cases := []struct {
+		method   string
+		path     string
+		code     int
+		expected string
+	}{
+		{http.MethodGet, "/ping", http.StatusOK, "pong"},
+		{http.MethodGet, "/legacy", http.StatusAccepted, "legacy /"},
+		{http.MethodPost, "/legacy/a/b/", http.StatusAccepted, "legacy /a/b/"},
+		{http.MethodGet, "/api/admin", http.StatusOK, "admin home"},
+		{http.MethodGet, "/api/admin/", http.StatusOK, "admin home"},
+		{http.MethodGet, "/api/admin/users/42", http.StatusOK, "admin user 42"},
+		{http.MethodGet, "/api/admin/missing", http.StatusNotFound, "<html>\n<body>\n    <h1>Page /missing not found</h1>\n</body>\n</html>\n"},
+		{http.MethodPost, "/api/admin/users/42", http.StatusMethodNotAllowed, "method POST not allowed for url /users/42"},
+	}
+	for _, tc := range cases {
+		req := httptest.NewRequest(tc.method, tc.path, nil)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+
+		assert.Equal(t, tc.code, w.Code, tc.path)
+		assert.Equal(t, tc.expected, w.Body.String(), tc.path)
+		assert.Equal(t, tc.code, status, tc.path)
+		assert.Equal(t, w.Body.Len(), size, tc.path)
+		assert.Equal(t, tc.path, req.URL.Path)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/api/admin/users/42", nil)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	assert.Equal(t, "api", w.Header().Get("X-Group"))
+
+	// the prefix may have params, and the escaping of the path below it is kept
+	r.Group("/t/:tenant").Mount("/files", http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Write([]byte(req.URL.Path + " " + req.URL.EscapedPath()))
+	}))
+	req = httptest.NewRequest(http.MethodGet, "/t/acme/files/a%2Fb/c", nil)
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	assert.Equal(t, "/a/b/c /a%2Fb/c", w.Body.String())
+	assert.Equal(t, "/t/acme/files/a%2Fb/c", req.URL.EscapedPath())
+}
+
+func TestRouterGroupVersion(t *testing.T) {
+	r := New()
+	r.DefaultVersion = "1"
+	r.Use(func(c *Context) { c.Header("X-Middleware", "global") })
+	r.GET("/health", func(c *Context) { c.String(http.StatusOK, "ok") })
+
+	api := r.Group("/api")
+	v1 := api.Version("1")
+	v1.GET("/users", func(c *Context) { c.String(http.StatusOK, "v1 users") })
+	v1.GET("/users/:id", func(c *Context) { c.String(http.StatusOK, "v1 user %s", c.Param("id")) })
+	v2 := api.Version("v2", func(c *Context) { c.Header("X-Version", "2") })
+	assert.Equal(t, "/api", v2.BasePath())
+	assert.Equal(t, "/", r.Version("3").BasePath())
+	v2.GET("/users", func(c *Context) { c.String(http.StatusOK, "v2 users") })
+
+	assert.Panics(t, func() { v1.GET("/users", func(c *Context) {}) })
+	assert.Panics(t, func() { api.GET("/users", func(c *Context) {}) })
+	assert.Panics(t, func() { r.Version("") })
+
+	serve := func(method, path, header, value string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, nil)
+		if header != "" {
+			req.Header.Set(header, value)
+		}
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	cases := []struct {
+		path     string
+		header   string
+		value    string
+		code     int
+		expected string
+	}{
+		{"/api/users", "", "", http.StatusOK, "v1 users"},
+		{"/api/users", "Api-Version", "2", http.StatusOK, "v2 users"},
+		{"/api/users", "Api-Version", "V2", http.StatusOK, "v2 users"},
+		{"/api/users", "Accept", "application/vnd.acme.v2+json", http.StatusOK, "v2 users"},
+		{"/api/users", "Accept", "text/html, application/vnd.acme.v1+json;q=0.9", http.StatusOK, "v1 users"},
+		{"/api/users", "Accept", "application/json", http.StatusOK, "v1 users"},
+		{"/api/users", "Api-Version", "3", http.StatusNotAcceptable, "no version of url /api/users is acceptable"},
+		{"/api/users/42", "Api-Version", "2", http.StatusNotAcceptable, "no version of url /api/users/42 is acceptable"},
+		{"/api/users/42", "", "", http.StatusOK, "v1 user 42"},
+		{"/health", "Api-Version", "3", http.StatusOK, "ok"},
+	}
+	for _, tc := range cases {
+		w := serve(http.MethodGet, tc.path, tc.header, tc.value)
+
+		assert.Equal(t, tc.code, w.Code, tc.header+": "+tc.value)
+		assert.Equal(t, tc.expected, w.Body.String(), tc.header+": "+tc.value)
+		assert.Equal(t, "global", w.Header().Get("X-Middleware"))
+	}
+	assert.Equal(t, "2", serve(http.MethodGet, "/api/users", "Api-Version", "2").Header().Get("X-Version"))
+	assert.Equal(t, "Accept, Api-Version", serve(http.MethodGet, "/api/users", "", "").Header().Get("Vary"))
+	assert.Equal(t, http.StatusMethodNotAllowed, serve(http.MethodPost, "/api/users", "", "").Code)
+
+	routes := r.Routes()
+	assert.Len(t, routes, 4)
+	assert.Equal(t, "/api/users", routes[1].Path)
+	assert.Equal(t, "1", routes[1].Version)
+	assert.Equal(t, "/api/users", routes[2].Path)
+	assert.Equal(t, "2", routes[2].Version)
+	assert.Equal(t, 2, routes[2].Middlewares)
+
+	v2.Replace(http.MethodGet, "/users", func(c *Context) { c.String(http.StatusOK, "v2 users replaced") })
+	assert.True(t, v1.Remove(http.MethodGet, "/users"))
+	assert.False(t, v1.Remove(http.MethodGet, "/users"))
+	assert.Equal(t, "v2 users replaced", serve(http.MethodGet, "/api/users", "Api-Version", "2").Body.String())
+	assert.Equal(t, http.StatusNotAcceptable, serve(http.MethodGet, "/api/users", "", "").Code)
+	assert.True(t, api.Remove(http.MethodGet, "/users"))
+	assert.Equal(t, http.StatusNotFound, serve(http.MethodGet, "/api/users", "Api-Version", "2").Code)
+}
@@ -0,0 +1,839 @@
+package yogin
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// freeAddr returns a loopback address nobody listens on.
+func freeAddr(t *testing.T) string {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	defer listener.Close()
+	return listener.Addr().String()
+}
+
+// startEngine runs r with run in a goroutine, and waits for it to be started, once the
+// server of run is registered and the OnStart hooks are done.
+// The returned channel receives the result of run.
+func startEngine(t *testing.T, r *Engine, run func() error) <-chan error {
+	r.serversMu.Lock()
+	servers := len(r.servers)
+	r.serversMu.Unlock()
+	started := func() bool {
+		r.serversMu.Lock()
+		defer r.serversMu.Unlock()
+		if len(r.servers) <= servers || r.start == nil {
+			return false
+		}
+		select {
+		case <-r.start.done:
+			return true
+		default:
+			return false
+		}
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		done <- run()
+	}()
+	deadline := time.After(5 * time.Second)
+	for !started() {
+		select {
+		case err := <-done:
+			t.Fatalf("engine stopped before starting: %v", err)
+		case <-deadline:
+			t.Fatal("engine did not start")
+		case <-time.After(time.Millisecond):
+		}
+	}
+	return done
+}
+
+func waitEngine(t *testing.T, done <-chan error) error {
+	select {
+	case err := <-done:
+		return err
+	case <-time.After(5 * time.Second):
+		t.Fatal("engine did not stop")
+		return nil
+	}
+}
+
+func TestRunWithContextGracefulShutdown(t *testing.T) {
+	r := New()
+	entered, release := make(chan struct{}), make(chan struct{})
+	r.GET("/slow", func(c *Context) {
+		close(entered)
+		<-release
+		c.String(http.StatusOK, "done")
+	})
+	var hooks []string
+	r.OnShutdown(func(ctx context.Context) error {
+		hooks = append(hooks, "flush logs")
+		return nil
+	}, func(ctx context.Context) error {
+		_, ok := ctx.Deadline()
+		assert.True(t, ok)
+		hooks = append(hooks, "close sessions")
+		return nil
+	})
+
+	addr := freeAddr(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	done := startEngine(t, r, func() error { return r.RunWithContext(ctx, addr) })
+
+	responses := make(chan *http.Response, 1)
+	go func() {
+		resp, err := http.Get("http://" + addr + "/slow")
+		assert.NoError(t, err)
+		responses <- resp
+	}()
+	<-entered
+	cancel()
+
+	// new connections are refused while the in-flight request is drained
+	assert.Eventually(t, func() bool {
+		conn, err := net.Dial("tcp", addr)
+		if err == nil {
+			conn.Close()
+		}
+		return err != nil
+	}, 5*time.Second, 10*time.Millisecond)
+	select {
+	case <-done:
+		t.Fatal("engine stopped before the in-flight request finished")
+	default:
+	}
+
+	close(release)
+	resp := <-responses
+	body, _ := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "done", string(body))
+
+	assert.NoError(t, waitEngine(t, done))
+	assert.Equal(t, []string{"flush logs", "close sessions"}, hooks)
+}
+
+func TestRunWithContextSignal(t *testing.T) {
+	r := New()
+	shutdown := 0
+	r.OnShutdown(func(ctx context.Context) error {
+		shutdown++
+		return nil
+	})
+	addr := freeAddr(t)
+	done := startEngine(t, r, func() error { return r.RunWithContext(context.Background(), addr) })
+
+	assert.NoError(t, syscall.Kill(syscall.Getpid(), syscall.SIGTERM))
+	assert.NoError(t, waitEngine(t, done))
+	assert.Equal(t, 1, shutdown)
+}
+
+func TestShutdownDeadline(t *testing.T) {
+	r := New()
+	entered, release := make(chan struct{}), make(chan struct{})
+	defer close(release)
+	r.GET("/slow", func(c *Context) {
+		close(entered)
+		<-release
+	})
+	hookErr := errors.New("session store unavailable")
+	shutdown := 0
+	r.OnShutdown(func(ctx context.Context) error {
+		shutdown++
+		return hookErr
+	})
+
+	addr := freeAddr(t)
+	done := startEngine(t, r, func() error { return r.RunWithContext(context.Background(), addr) })
+	go http.Get("http://" + addr + "/slow")
+	<-entered
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	assert.Equal(t, context.DeadlineExceeded, r.Shutdown(ctx))
+	assert.Equal(t, context.DeadlineExceeded, waitEngine(t, done))
+	assert.Equal(t, 1, shutdown)
+
+	// the servers are already stopped, the result is the one of the first call
+	assert.Equal(t, context.DeadlineExceeded, r.Shutdown(context.Background()))
+	assert.Equal(t, 1, shutdown)
+
+	// without deadline, the error of the hooks is returned
+	r = New()
+	r.OnShutdown(func(ctx context.Context) error { return hookErr })
+	ctx, cancel = context.WithCancel(context.Background())
+	done = startEngine(t, r, func() error { return r.RunWithContext(ctx, freeAddr(t)) })
+	cancel()
+	assert.Equal(t, hookErr, waitEngine(t, done))
+}
+
+func TestShutdownMultipleRuns(t *testing.T) {
+	r := New()
+	entered, release := make(chan struct{}), make(chan struct{})
+	r.GET("/slow", func(c *Context) {
+		close(entered)
+		<-release
+		c.String(http.StatusOK, "done")
+	})
+	var hooks, startHooks int32
+	r.OnStart(func() error {
+		atomic.AddInt32(&startHooks, 1)
+		return nil
+	})
+	r.OnShutdown(func(ctx context.Context) error {
+		atomic.AddInt32(&hooks, 1)
+		return nil
+	})
+
+	first, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	second, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	doneFirst := startEngine(t, r, func() error { return r.RunListener(first) })
+	doneSecond := startEngine(t, r, func() error { return r.RunListener(second) })
+	// the hooks run once for both Run calls
+	assert.Equal(t, int32(1), atomic.LoadInt32(&startHooks))
+
+	go http.Get("http://" + first.Addr().String() + "/slow")
+	<-entered
+
+	// both Run calls and Shutdown calls wait for the in-flight request and the hooks
+	shutdowns := make(chan error, 2)
+	for i := 0; i < 2; i++ {
+		go func() {
+			shutdowns <- r.Shutdown(context.Background())
+		}()
+	}
+	for _, listener := range []net.Listener{first, second} {
+		assert.Eventually(t, func() bool {
+			conn, err := net.Dial("tcp", listener.Addr().String())
+			if err == nil {
+				conn.Close()
+			}
+			return err != nil
+		}, 5*time.Second, 10*time.Millisecond)
+	}
+	select {
+	case <-doneFirst:
+		t.Fatal("first Run returned before the in-flight request finished")
+	case <-doneSecond:
+		t.Fatal("second Run returned before the in-flight request finished")
+	case <-shutdowns:
+		t.Fatal("Shutdown returned before the in-flight request finished")
+	default:
+	}
+
+	close(release)
+	assert.NoError(t, waitEngine(t, doneFirst))
+	assert.NoError(t, waitEngine(t, doneSecond))
+	assert.NoError(t, <-shutdowns)
+	assert.NoError(t, <-shutdowns)
+	assert.Equal(t, int32(1), atomic.LoadInt32(&hooks))
+
+	// and again once the engine is shut down
+	third, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	done := startEngine(t, r, func() error { return r.RunListener(third) })
+	assert.Equal(t, int32(2), atomic.LoadInt32(&startHooks))
+	assert.NoError(t, r.Shutdown(context.Background()))
+	assert.NoError(t, waitEngine(t, done))
+	assert.Equal(t, int32(2), atomic.LoadInt32(&hooks))
+}
+
+func TestRunOnStartError(t *testing.T) {
+	r := New()
+	startErr := errors.New("can not connect to the database")
+	r.OnStart(func() error { return startErr })
+
+	addr := freeAddr(t)
+	assert.Equal(t, startErr, r.RunWithContext(context.Background(), addr))
+
+	// the address is released
+	listener, err := net.Listen("tcp", addr)
+	assert.NoError(t, err)
+	listener.Close()
+
+	assert.Error(t, r.Run("256.0.0.1:http"))
+}
+
+func getBody(t *testing.T, client *http.Client, url string) string {
+	resp, err := client.Get(url)
+	if !assert.NoError(t, err) {
+		return ""
+	}
+	defer resp.Body.Close()
+	body, _ := ioutil.ReadAll(resp.Body)
+	return string(body)
+}
+
+func newPingEngine() *Engine {
+	r := New()
+	r.GET("/ping", func(c *Context) { c.String(http.StatusOK, "pong") })
+	return r
+}
+
+func TestRunTLS(t *testing.T) {
+	dir, err := ioutil.TempDir("", "yogin")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	certFile, keyFile := filepath.Join(dir, "dev.crt"), filepath.Join(dir, "dev.key")
+	assert.NoError(t, GenerateDevCert(certFile, keyFile))
+	info, err := os.Stat(keyFile)
+	assert.NoError(t, err)
+	assert.Equal(t, os.FileMode(0600), info.Mode().Perm())
+
+	certPEM, err := ioutil.ReadFile(certFile)
+	assert.NoError(t, err)
+	roots := x509.NewCertPool()
+	assert.True(t, roots.AppendCertsFromPEM(certPEM))
+	client := &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{RootCAs: roots}}}
+
+	r := newPingEngine()
+	addr := freeAddr(t)
+	done := startEngine(t, r, func() error { return r.RunTLS(addr, certFile, keyFile) })
+	_, port, _ := net.SplitHostPort(addr)
+	assert.Equal(t, "pong", getBody(t, client, "https://localhost:"+port+"/ping"))
+	assert.Equal(t, "pong", getBody(t, client, "https://127.0.0.1:"+port+"/ping"))
+	assert.NoError(t, r.Shutdown(context.Background()))
+	assert.NoError(t, waitEngine(t, done))
+
+	r = newPingEngine()
+	assert.Error(t, r.RunTLS(freeAddr(t), filepath.Join(dir, "missing.crt"), keyFile))
+}
+
+func TestRunUnix(t *testing.T) {
+	dir, err := ioutil.TempDir("", "yogin")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "yogin.sock")
+	client := &http.Client{Transport: &http.Transport{
+		DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+			return (&net.Dialer{}).DialContext(ctx, "unix", file)
+		},
+	}}
+
+	// a stale socket is replaced
+	stale, err := net.Listen("unix", file)
+	assert.NoError(t, err)
+	stale.(*net.UnixListener).SetUnlinkOnClose(false)
+	stale.Close()
+
+	r := newPingEngine()
+	r.UnixSocketMode = 0660
+	done := startEngine(t, r, func() error { return r.RunUnix(file) })
+	info, err := os.Stat(file)
+	assert.NoError(t, err)
+	assert.Equal(t, os.FileMode(0660), info.Mode().Perm())
+	assert.Equal(t, "pong", getBody(t, client, "http://yogin/ping"))
+
+	// a socket in use is not
+	assert.Error(t, newPingEngine().RunUnix(file))
+	assert.Equal(t, "pong", getBody(t, client, "http://yogin/ping"))
+
+	assert.NoError(t, r.Shutdown(context.Background()))
+	assert.NoError(t, waitEngine(t, done))
+	_, err = os.Stat(file)
+	assert.True(t, os.IsNotExist(err))
+
+	// neither is any other file
+	assert.NoError(t, ioutil.WriteFile(file, []byte("data"), 0644))
+	assert.Error(t, newPingEngine().RunUnix(file))
+	data, err := ioutil.ReadFile(file)
+	assert.NoError(t, err)
+	assert.Equal(t, "data", string(data))
+
+	// the connections made before the socket got its permissions are closed
+	pending, err := net.Listen("unix", filepath.Join(dir, "pending.sock"))
+	assert.NoError(t, err)
+	defer pending.Close()
+	early, err := net.Dial("unix", pending.Addr().String())
+	assert.NoError(t, err)
+	defer early.Close()
+	assert.NoError(t, closePending(pending.(*net.UnixListener)))
+	early.SetReadDeadline(time.Now().Add(5 * time.Second))
+	_, err = early.Read(make([]byte, 1))
+	assert.Equal(t, io.EOF, err)
+	late, err := net.Dial("unix", pending.Addr().String())
+	assert.NoError(t, err)
+	defer late.Close()
+	conn, err := pending.Accept()
+	assert.NoError(t, err)
+	conn.Close()
+}
+
+func TestRunListenerAndFd(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	addr := listener.Addr().String()
+
+	r := newPingEngine()
+	done := startEngine(t, r, func() error { return r.RunListener(listener) })
+	assert.Equal(t, "pong", getBody(t, http.DefaultClient, "http://"+addr+"/ping"))
+	assert.NoError(t, r.Shutdown(context.Background()))
+	assert.NoError(t, waitEngine(t, done))
+
+	listener, err = net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	addr = listener.Addr().String()
+	f, err := listener.(*net.TCPListener).File()
+	assert.NoError(t, err)
+	listener.Close()
+	// RunFd owns the descriptor it is given, f closes its own
+	fd, err := syscall.Dup(int(f.Fd()))
+	assert.NoError(t, err)
+	f.Close()
+
+	r = newPingEngine()
+	done = startEngine(t, r, func() error { return r.RunFd(fd) })
+	assert.Equal(t, "pong", getBody(t, http.DefaultClient, "http://"+addr+"/ping"))
+	assert.NoError(t, r.Shutdown(context.Background()))
+	assert.NoError(t, waitEngine(t, done))
+
+	assert.Error(t, New().RunFd(-1))
+}
+
+func TestClientIP(t *testing.T) {
+	r := New()
+	r.GET("/ip", func(c *Context) { c.String(http.StatusOK, "%s %s", c.ClientIP, c.RemoteIP()) })
+	serve := func(remoteAddr string, headers ...string) string {
+		req := httptest.NewRequest(http.MethodGet, "/ip", nil)
+		req.RemoteAddr = remoteAddr
+		for i := 0; i < len(headers); i += 2 {
+			req.Header.Add(headers[i], headers[i+1])
+		}
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w.Body.String()
+	}
+
+	// no proxy is trusted by default
+	assert.Equal(t, "10.0.0.1 10.0.0.1", serve("10.0.0.1:1234", "X-Forwarded-For", "203.0.113.5"))
+	assert.Equal(t, " ", serve("@", "X-Forwarded-For", "203.0.113.5"))
+
+	assert.EqualError(t, r.SetTrustedProxies([]string{"10.0.0.0/33"}), `invalid trusted proxy "10.0.0.0/33": invalid CIDR address: 10.0.0.0/33`)
+	assert.EqualError(t, r.SetTrustedProxies([]string{"proxy.example.com"}), `invalid trusted proxy "proxy.example.com"`)
+	assert.NoError(t, r.SetTrustedProxies([]string{"10.0.0.0/8", "192.0.2.1", "2001:db8::1", "unix"}))
+
+	cases := []struct {
+		remoteAddr string
+		headers    []string
+		expected   string
+	}{
+		{"10.0.0.1:1234", []string{"X-Forwarded-For", "203.0.113.5, 10.0.0.2"}, "203.0.113.5 10.0.0.1"},
+		{"10.0.0.1:1234", []string{"X-Forwarded-For", "1.1.1.1, 203.0.113.5, 10.0.0.2"}, "203.0.113.5 10.0.0.1"},
+		{"10.0.0.1:1234", []string{"X-Forwarded-For", "10.1.1.1, 10.0.0.2"}, "10.1.1.1 10.0.0.1"},
+		{"10.0.0.1:1234", []string{"X-Forwarded-For", "203.0.113.5", "X-Forwarded-For", "192.0.2.1"}, "203.0.113.5 10.0.0.1"},
+		{"10.0.0.1:1234", []string{"X-Forwarded-For", "203.0.113.5:4711"}, "203.0.113.5 10.0.0.1"},
+		{"10.0.0.1:1234", []string{"X-Forwarded-For", "garbage, 10.0.0.2", "X-Real-IP", "198.51.100.7"}, "198.51.100.7 10.0.0.1"},
+		{"10.0.0.1:1234", []string{"X-Forwarded-For", "garbage"}, "10.0.0.1 10.0.0.1"},
+		{"10.0.0.1:1234", nil, "10.0.0.1 10.0.0.1"},
+		{"[2001:db8::1]:443", []string{"X-Real-IP", "198.51.100.7"}, "198.51.100.7 2001:db8::1"},
+		{"203.0.113.9:1234", []string{"X-Forwarded-For", "198.51.100.7"}, "203.0.113.9 203.0.113.9"},
+		{"@", []string{"X-Forwarded-For", "198.51.100.7"}, "198.51.100.7 "},
+	}
+	for _, tc := range cases {
+		assert.Equal(t, tc.expected, serve(tc.remoteAddr, tc.headers...), tc.headers)
+	}
+
+	r.RemoteIPHeaders = []string{"Forwarded", "X-Forwarded-For"}
+	forwarded := []struct {
+		forwarded string
+		expected  string
+	}{
+		{`for=192.0.2.60;proto=http;by=203.0.113.43`, "192.0.2.60 10.0.0.1"},
+		{`For="[2001:db8:cafe::17]:4711"`, "2001:db8:cafe::17 10.0.0.1"},
+		{`for=198.51.100.7, for=192.0.2.1;proto=https, for=10.0.0.3`, "198.51.100.7 10.0.0.1"},
+		{`for=unknown, for=10.0.0.3`, "203.0.113.5 10.0.0.1"},
+		{`for=_hidden`, "203.0.113.5 10.0.0.1"},
+		{`proto=https`, "203.0.113.5 10.0.0.1"},
+	}
+	for _, tc := range forwarded {
+		assert.Equal(t, tc.expected, serve("10.0.0.1:1234", "Forwarded", tc.forwarded, "X-Forwarded-For", "203.0.113.5"), tc.forwarded)
+	}
+}
+
+// lockedBuffer is a bytes.Buffer safe for the concurrent writes of the Logger.
+type lockedBuffer struct {
+	sync.Mutex
+	bytes.Buffer
+}
+
+func (b *lockedBuffer) Write(p []byte) (int, error) {
+	b.Lock()
+	defer b.Unlock()
+	return b.Buffer.Write(p)
+}
+
+func (b *lockedBuffer) String() string {
+	b.Lock()
+	defer b.Unlock()
+	return b.Buffer.String()
+}
+
+func TestProxyProtocol(t *testing.T) {
+	out := &lockedBuffer{}
+	defer func(w io.Writer) { DefaultWriter = w }(DefaultWriter)
+	DefaultWriter = out
+
+	r := New()
+	r.Use(Logger())
+	r.GET("/ip", func(c *Context) { c.String(http.StatusOK, "%s %s", c.ClientIP, c.RemoteIP()) })
+	assert.EqualError(t, r.UseProxyProtocol([]string{"not an ip"}), `invalid trusted upstream "not an ip"`)
+	assert.NoError(t, r.UseProxyProtocol([]string{"127.0.0.1"}))
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	addr := listener.Addr().String()
+	done := startEngine(t, r, func() error { return r.RunListener(listener) })
+
+	request := func(header []byte) (string, error) {
+		conn, err := net.Dial("tcp", addr)
+		if err != nil {
+			return "", err
+		}
+		defer conn.Close()
+		conn.Write(header)
+		conn.Write([]byte("GET /ip HTTP/1.1\r\nHost: localhost\r\nConnection: close\r\n\r\n"))
+		resp, err := http.ReadResponse(bufio.NewReader(conn), nil)
+		if err != nil {
+			return "", err
+		}
+		defer resp.Body.Close()
+		body, err := ioutil.ReadAll(resp.Body)
+		return string(body), err
+	}
+	v2 := func(command, family byte, addresses ...byte) []byte {
+		header := append([]byte("\r\n\r\n\x00\r\nQUIT\n"), 0x20|command, family, 0, byte(len(addresses)))
+		return append(header, addresses...)
+	}
+
+	cases := []struct {
+		header   []byte
+		expected string
+	}{
+		{nil, "127.0.0.1 127.0.0.1"},
+		{[]byte("PROXY TCP4 192.0.2.1 127.0.0.1 56324 80\r\n"), "192.0.2.1 192.0.2.1"},
+		{[]byte("PROXY TCP6 2001:db8::1 ::1 56324 80\r\n"), "2001:db8::1 2001:db8::1"},
+		{[]byte("PROXY UNKNOWN\r\n"), "127.0.0.1 127.0.0.1"},
+		{v2(1, 0x11, 198, 51, 100, 7, 127, 0, 0, 1, 0xdc, 0x04, 0, 80), "198.51.100.7 198.51.100.7"},
+		// the TLVs after the addresses are skipped
+		{v2(1, 0x11, 198, 51, 100, 7, 127, 0, 0, 1, 0xdc, 0x04, 0, 80, 0x04, 0, 1, 0), "198.51.100.7 198.51.100.7"},
+		{v2(1, 0x21, append(append(net.ParseIP("2001:db8::2"), net.IPv6loopback...), 0xdc, 0x04, 0, 80)...), "2001:db8::2 2001:db8::2"},
+		{v2(0, 0x00), "127.0.0.1 127.0.0.1"},
+	}
+	for _, tc := range cases {
+		body, err := request(tc.header)
+		assert.NoError(t, err, "%q", tc.header)
+		assert.Equal(t, tc.expected, body, "%q", tc.header)
+	}
+	assert.Contains(t, out.String(), "198.51.100.7")
+
+	for _, header := range []string{"PROXY TCP4 192.0.2.1\r\n", "PROXY TCP4 ::1 127.0.0.1 1 80\r\n", "PROXY TCP4 192.0.2.1 127.0.0.1 56324 80"} {
+		_, err := request([]byte(header))
+		assert.Error(t, err, "%q", header)
+	}
+	_, err = request(v2(2, 0x11))
+	assert.Error(t, err)
+
+	assert.NoError(t, r.Shutdown(context.Background()))
+	assert.NoError(t, waitEngine(t, done))
+
+	// the headers of untrusted upstreams are not parsed
+	listener, err = net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	_, err = NewProxyProtocolListener(listener, []string{"10.0.0.0/8", "lb"})
+	assert.EqualError(t, err, `invalid trusted upstream "lb"`)
+	listener, err = NewProxyProtocolListener(listener, []string{"10.0.0.0/8"})
+	assert.NoError(t, err)
+	addr = listener.Addr().String()
+	r = New()
+	r.GET("/ip", func(c *Context) { c.String(http.StatusOK, "%s %s", c.ClientIP, c.RemoteIP()) })
+	done = startEngine(t, r, func() error { return r.RunListener(listener) })
+	body, err := request(nil)
+	assert.NoError(t, err)
+	assert.Equal(t, "127.0.0.1 127.0.0.1", body)
+	body, err = request([]byte("PROXY TCP4 192.0.2.1 127.0.0.1 56324 80\r\n"))
+	assert.NoError(t, err)
+	assert.Equal(t, "400 Bad Request", body)
+	assert.NoError(t, r.Shutdown(context.Background()))
+	assert.NoError(t, waitEngine(t, done))
+}
+
+// restartTestAddr is set to run the process started by TestRestart.
+const restartTestAddr = "YOGIN_TEST_RESTART_ADDR"
+
+func isNonblocking(fd int) bool {
+	flags, _, errno := syscall.Syscall(syscall.SYS_FCNTL, uintptr(fd), syscall.F_GETFL, 0)
+	return errno == 0 && flags&syscall.O_NONBLOCK != 0
+}
+
+func TestMain(m *testing.M) {
+	if addr := os.Getenv(restartTestAddr); addr != "" && os.Getenv(envListenFds) != "" {
+		// the mode of the socket as inherited, before the engine takes it over
+		nonblocking := isNonblocking(3)
+		r := New()
+		r.GracefulRestart = true
+		r.GET("/pid", func(c *Context) {
+			c.Header("X-Nonblocking", strconv.FormatBool(nonblocking))
+			c.String(http.StatusOK, "%d", os.Getpid())
+		})
+		if err := r.Run(addr); err != nil {
+			os.Exit(1)
+		}
+		os.Exit(0)
+	}
+	os.Exit(m.Run())
+}
+
+func TestRestart(t *testing.T) {
+	assert.Error(t, New().Restart())
+
+	addr := freeAddr(t)
+	os.Setenv(restartTestAddr, addr)
+	defer os.Unsetenv(restartTestAddr)
+
+	r := New()
+	r.GracefulRestart = true
+	entered, release := make(chan struct{}), make(chan struct{})
+	r.GET("/pid", func(c *Context) { c.String(http.StatusOK, "%d", os.Getpid()) })
+	r.GET("/slow", func(c *Context) {
+		close(entered)
+		<-release
+		c.String(http.StatusOK, "done")
+	})
+	done := startEngine(t, r, func() error { return r.RunWithContext(context.Background(), addr) })
+	client := &http.Client{Transport: &http.Transport{DisableKeepAlives: true}}
+	assert.Equal(t, strconv.Itoa(os.Getpid()), getBody(t, client, "http://"+addr+"/pid"))
+
+	// the duplicate shares the blocking mode of the socket once the listener is closed
+	r.serversMu.Lock()
+	socket := -1
+	for _, listener := range r.servers {
+		var err error
+		socket, err = dupListener(listener)
+		assert.NoError(t, err)
+	}
+	r.serversMu.Unlock()
+	defer syscall.Close(socket)
+	assert.True(t, isNonblocking(socket))
+
+	slow := make(chan string, 1)
+	go func() {
+		slow <- getBody(t, client, "http://"+addr+"/slow")
+	}()
+	<-entered
+	assert.NoError(t, syscall.Kill(os.Getpid(), syscall.SIGUSR2))
+
+	// the new process serves the new connections while the in-flight request is drained
+	var pid int
+	var nonblocking string
+	assert.Eventually(t, func() bool {
+		resp, err := client.Get("http://" + addr + "/pid")
+		if !assert.NoError(t, err) {
+			return false
+		}
+		defer resp.Body.Close()
+		body, _ := ioutil.ReadAll(resp.Body)
+		pid, _ = strconv.Atoi(string(body))
+		nonblocking = resp.Header.Get("X-Nonblocking")
+		return pid > 0 && pid != os.Getpid()
+	}, 30*time.Second, 10*time.Millisecond)
+	if pid > 0 && pid != os.Getpid() {
+		t.Cleanup(func() {
+			syscall.Kill(pid, syscall.SIGTERM)
+		})
+	}
+	select {
+	case <-done:
+		t.Fatal("engine stopped before the in-flight request finished")
+	default:
+	}
+	// a socket switched to blocking mode, even until the new process takes it over,
+	// may keep accepting connections once the engine is shut down
+	assert.Equal(t, "true", nonblocking)
+	assert.True(t, isNonblocking(socket))
+
+	close(release)
+	assert.Equal(t, "done", <-slow)
+	assert.NoError(t, waitEngine(t, done))
+}
+
+func TestInheritedListeners(t *testing.T) {
+	// the variables of another process are left alone
+	os.Setenv("LISTEN_PID", strconv.Itoa(os.Getpid()+1))
+	os.Setenv("LISTEN_FDS", "2")
+	first, count := listenFds()
+	assert.Equal(t, 3, first)
+	assert.Equal(t, 0, count)
+	assert.Equal(t, "2", os.Getenv("LISTEN_FDS"))
+
+	// only the consumed ones are unset
+	os.Setenv("LISTEN_PID", strconv.Itoa(os.Getpid()))
+	os.Setenv("LISTEN_FDNAMES", "http:https")
+	first, count = listenFds()
+	assert.Equal(t, 3, first)
+	assert.Equal(t, 2, count)
+	for _, env := range []string{"LISTEN_PID", "LISTEN_FDS"} {
+		_, ok := os.LookupEnv(env)
+		assert.False(t, ok, env)
+	}
+	assert.Equal(t, "http:https", os.Getenv("LISTEN_FDNAMES"))
+	os.Unsetenv("LISTEN_FDNAMES")
+
+	os.Setenv(envListenFds, "1")
+	os.Setenv("LISTEN_PID", strconv.Itoa(os.Getpid()))
+	os.Setenv("LISTEN_FDS", "2")
+	first, count = listenFds()
+	assert.Equal(t, 1, count)
+	_, ok := os.LookupEnv(envListenFds)
+	assert.False(t, ok)
+	assert.Equal(t, "2", os.Getenv("LISTEN_FDS"))
+	os.Unsetenv("LISTEN_PID")
+	os.Unsetenv("LISTEN_FDS")
+
+	// the engines without GracefulRestart leave the inherited sockets alone
+	os.Setenv("LISTEN_PID", strconv.Itoa(os.Getpid()))
+	os.Setenv("LISTEN_FDS", "1")
+	r := newPingEngine()
+	done := startEngine(t, r, func() error { return r.RunWithContext(context.Background(), freeAddr(t)) })
+	assert.NoError(t, r.Shutdown(context.Background()))
+	assert.NoError(t, waitEngine(t, done))
+	assert.Equal(t, "1", os.Getenv("LISTEN_FDS"))
+	os.Unsetenv("LISTEN_PID")
+	os.Unsetenv("LISTEN_FDS")
+
+	all, err := net.Listen("tcp", ":0")
+	assert.NoError(t, err)
+	defer all.Close()
+	port := strconv.Itoa(all.Addr().(*net.TCPAddr).Port)
+	loopback, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	defer loopback.Close()
+	socket := filepath.Join(t.TempDir(), "yogin.sock")
+	unix, err := net.Listen("unix", socket)
+	assert.NoError(t, err)
+	defer unix.Close()
+
+	assert.True(t, listensOn(all, "tcp", ":"+port))
+	assert.True(t, listensOn(all, "tcp", "0.0.0.0:"+port))
+	assert.False(t, listensOn(all, "tcp", "127.0.0.1:"+port))
+	assert.False(t, listensOn(all, "unix", ":"+port))
+	assert.True(t, listensOn(loopback, "tcp", loopback.Addr().String()))
+	assert.False(t, listensOn(loopback, "tcp", ":"+strconv.Itoa(loopback.Addr().(*net.TCPAddr).Port)))
+	assert.True(t, listensOn(unix, "unix", socket))
+	assert.False(t, listensOn(unix, "unix", socket+"2"))
+
+	// the inherited descriptors are raw ones, without an *os.File to close them again
+	rawFd := func(filer interface{ File() (*os.File, error) }) int {
+		f, err := filer.File()
+		assert.NoError(t, err)
+		defer f.Close()
+		fd, err := syscall.Dup(int(f.Fd()))
+		assert.NoError(t, err)
+		return fd
+	}
+	tcpFd := rawFd(all.(*net.TCPListener))
+	defer syscall.Close(tcpFd)
+	unix.(*net.UnixListener).SetUnlinkOnClose(false)
+	unixFd := rawFd(unix.(*net.UnixListener))
+	defer syscall.Close(unixFd)
+	all.Close()
+	unix.Close()
+	udp, err := net.ListenPacket("udp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	defer udp.Close()
+	udpFd := rawFd(udp.(*net.UDPConn))
+	defer syscall.Close(udpFd)
+
+	// the listeners inherited below are dropped, as their descriptors may be reused
+	inherited.mu.Lock()
+	previous := inherited.listeners
+	inherited.mu.Unlock()
+	defer func() {
+		inherited.mu.Lock()
+		for _, listener := range inherited.listeners[len(previous):] {
+			listener.Close()
+		}
+		inherited.listeners = previous
+		inherited.mu.Unlock()
+	}()
+
+	inheritFds(tcpFd, 1)
+	inheritFds(unixFd, 1)
+	inheritFds(udpFd, 1)
+	// the listening sockets are closed on exec, the datagram one is left to the application
+	closeOnExec := func(fd int) bool {
+		flags, _, errno := syscall.Syscall(syscall.SYS_FCNTL, uintptr(fd), syscall.F_GETFD, 0)
+		assert.Zero(t, errno)
+		return flags&syscall.FD_CLOEXEC != 0
+	}
+	assert.True(t, closeOnExec(tcpFd))
+	assert.True(t, closeOnExec(unixFd))
+	assert.False(t, closeOnExec(udpFd))
+	listener, err := takeListenerFd(udpFd)
+	assert.Nil(t, listener)
+	assert.NoError(t, err)
+
+	// only the engines with GracefulRestart take the inherited sockets
+	graceful := func() *Engine {
+		r := newPingEngine()
+		r.GracefulRestart = true
+		return r
+	}
+	assert.Nil(t, New().inheritedListener("tcp", ":"+port))
+	assert.Nil(t, graceful().inheritedListener("tcp", "127.0.0.1:"+port))
+	assert.NotNil(t, graceful().inheritedListener("tcp", ":"+port))
+	assert.Nil(t, graceful().inheritedListener("tcp", ":"+port))
+	assert.Error(t, graceful().RunFd(tcpFd))
+
+	r = graceful()
+	done = startEngine(t, r, func() error { return r.RunFd(unixFd) })
+	client := &http.Client{Transport: &http.Transport{
+		DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+			return net.Dial("unix", socket)
+		},
+	}}
+	assert.Equal(t, "pong", getBody(t, client, "http://unix/ping"))
+	assert.NoError(t, r.Shutdown(context.Background()))
+	assert.NoError(t, waitEngine(t, done))
+	assert.Nil(t, takeListener("unix", socket))
+
+	// RunUnix removes the socket file it inherited once the engine is shut down
+	socket = filepath.Join(t.TempDir(), "yogin.sock")
+	unix, err = net.Listen("unix", socket)
+	assert.NoError(t, err)
+	unix.(*net.UnixListener).SetUnlinkOnClose(false)
+	unixFd = rawFd(unix.(*net.UnixListener))
+	defer syscall.Close(unixFd)
+	unix.Close()
+	inheritFds(unixFd, 1)
+	r = graceful()
+	done = startEngine(t, r, func() error { return r.RunUnix(socket) })
+	assert.Equal(t, "pong", getBody(t, client, "http://unix/ping"))
+	assert.NoError(t, r.Shutdown(context.Background()))
+	assert.NoError(t, waitEngine(t, done))
+	_, err = os.Lstat(socket)
+	assert.True(t, os.IsNotExist(err))
+}
@@ -0,0 +1,193 @@
+package yogin
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// proxyHeaderTimeout is how long a connection has to send its PROXY protocol header.
+const proxyHeaderTimeout = 5 * time.Second
+
+// proxyV2Signature starts the binary header of the version 2 of the PROXY protocol.
+var proxyV2Signature = []byte("\r\n\r\n\x00\r\nQUIT\n")
+
+// UseProxyProtocol makes the Run methods accept the HAProxy PROXY protocol header, in
+// its v1 text or v2 binary format, from the given upstreams, e.g. the L4 load balancers.
+// The upstreams are IPs or CIDRs as for SetTrustedProxies. The client address of the
+// header then replaces the one of the connection, and so is the ClientIP and the one
+// of the Logger, see Context.RemoteIP. The connections of other peers are served as is.
+//     router.UseProxyProtocol([]string{"10.0.0.0/8"})
+//     router.Run(":8080")
+func (engine *Engine) UseProxyProtocol(trustedUpstreams []string) error {
+	upstreams, err := parseTrustedNets(trustedUpstreams)
+	if err != nil {
+		return fmt.Errorf("invalid trusted upstream %v", err)
+	}
+	engine.proxyUpstreams = &upstreams
+	return nil
+}
+
+// NewProxyProtocolListener wraps listener so that its connections from the given upstreams
+// may start with a PROXY protocol header, see Engine.UseProxyProtocol. It can be used
+// with RunListener, or any http.Server.
+func NewProxyProtocolListener(listener net.Listener, trustedUpstreams []string) (net.Listener, error) {
+	upstreams, err := parseTrustedNets(trustedUpstreams)
+	if err != nil {
+		return nil, fmt.Errorf("invalid trusted upstream %v", err)
+	}
+	return &proxyProtocolListener{Listener: listener, upstreams: upstreams}, nil
+}
+
+type proxyProtocolListener struct {
+	net.Listener
+	upstreams trustedNets
+}
+
+func (l *proxyProtocolListener) Accept() (net.Conn, error) {
+	conn, err := l.Listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+	ip, _, err := net.SplitHostPort(conn.RemoteAddr().String())
+	if err != nil {
+		ip = ""
+	}
+	if !l.upstreams.contains(ip) {
+		return conn, nil
+	}
+	return &proxyProtocolConn{Conn: conn, reader: bufio.NewReader(conn)}, nil
+}
+
+// proxyProtocolConn reads the PROXY protocol header when it is first used, so that a
+// slow upstream does not block the accepting goroutine.
+type proxyProtocolConn struct {
+	net.Conn
+	reader     *bufio.Reader
+	once       sync.Once
+	remoteAddr net.Addr // of the header, if any
+	err        error
+}
+
+func (c *proxyProtocolConn) Read(b []byte) (int, error) {
+	c.once.Do(c.readHeader)
+	if c.err != nil {
+		return 0, c.err
+	}
+	return c.reader.Read(b)
+}
+
+func (c *proxyProtocolConn) RemoteAddr() net.Addr {
+	c.once.Do(c.readHeader)
+	if c.remoteAddr != nil {
+		return c.remoteAddr
+	}
+	return c.Conn.RemoteAddr()
+}
+
+func (c *proxyProtocolConn) readHeader() {
+	c.Conn.SetReadDeadline(time.Now().Add(proxyHeaderTimeout))
+	defer c.Conn.SetReadDeadline(time.Time{})
+
+	first, err := c.reader.Peek(1)
+	if err != nil {
+		c.err = err
+		return
+	}
+	switch first[0] {
+	case 'P':
+		if prefix, err := c.reader.Peek(6); err == nil && string(prefix) == "PROXY " {
+			c.remoteAddr, c.err = readProxyHeaderV1(c.reader)
+		}
+	case proxyV2Signature[0]:
+		if prefix, err := c.reader.Peek(len(proxyV2Signature)); err == nil && bytes.Equal(prefix, proxyV2Signature) {
+			c.remoteAddr, c.err = readProxyHeaderV2(c.reader)
+		}
+	}
+	if c.err != nil {
+		c.Conn.Close()
+	}
+}
+
+// readProxyHeaderV1 reads a header like PROXY TCP4 192.0.2.1 10.0.0.1 56324 443\r\n.
+// The address of PROXY UNKNOWN headers is nil.
+func readProxyHeaderV1(reader *bufio.Reader) (net.Addr, error) {
+	const maxLength = 107
+	var line []byte
+	for !bytes.HasSuffix(line, []byte("\r\n")) {
+		if len(line) == maxLength {
+			return nil, errors.New("proxy protocol: v1 header too long")
+		}
+		b, err := reader.ReadByte()
+		if err != nil {
+			return nil, err
+		}
+		line = append(line, b)
+	}
+
+	fields := strings.Split(strings.TrimSuffix(string(line), "\r\n"), " ")
+	if len(fields) >= 2 && fields[1] == "UNKNOWN" {
+		return nil, nil
+	}
+	if len(fields) != 6 || fields[1] != "TCP4" && fields[1] != "TCP6" {
+		return nil, fmt.Errorf("proxy protocol: invalid v1 header %q", line)
+	}
+	ip := net.ParseIP(fields[2])
+	port, err := strconv.ParseUint(fields[4], 10, 16)
+	if ip == nil || err != nil || (ip.To4() != nil) != (fields[1] == "TCP4") {
+		return nil, fmt.Errorf("proxy protocol: invalid v1 header %q", line)
+	}
+	return &net.TCPAddr{IP: ip, Port: int(port)}, nil
+}
+
+// readProxyHeaderV2 reads a binary header. The address of LOCAL commands, e.g. health
+// checks of the upstream, and of unsupported address families is nil.
+func readProxyHeaderV2(reader *bufio.Reader) (net.Addr, error) {
+	header := make([]byte, len(proxyV2Signature)+4)
+	if _, err := io.ReadFull(reader, header); err != nil {
+		return nil, err
+	}
+	versionCommand, family := header[12], header[13]
+	payload := make([]byte, binary.BigEndian.Uint16(header[14:]))
+	if _, err := io.ReadFull(reader, payload); err != nil {
+		return nil, err
+	}
+
+	if versionCommand>>4 != 2 {
+		return nil, fmt.Errorf("proxy protocol: unsupported version %d", versionCommand>>4)
+	}
+	switch versionCommand & 0xf {
+	case 0: // LOCAL
+		return nil, nil
+	case 1: // PROXY
+	default:
+		return nil, fmt.Errorf("proxy protocol: unsupported command %d", versionCommand&0xf)
+	}
+
+	var ipLength int
+	switch family >> 4 {
+	case 1: // AF_INET
+		ipLength = net.IPv4len
+	case 2: // AF_INET6
+		ipLength = net.IPv6len
+	default:
+		return nil, nil
+	}
+	if len(payload) < 2*ipLength+4 {
+		return nil, errors.New("proxy protocol: v2 address too short")
+	}
+	ip := net.IP(payload[:ipLength])
+	port := binary.BigEndian.Uint16(payload[2*ipLength:])
+	if family&0xf == 2 { // DGRAM
+		return &net.UDPAddr{IP: ip, Port: int(port)}, nil
+	}
+	return &net.TCPAddr{IP: ip, Port: int(port)}, nil
+}
@@ -0,0 +1,151 @@
+package yogin
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// envListenFds and envReadyFd tell the process started by Restart the number of
+	// listening sockets it inherits, from fd 3, and the pipe to close once it is ready.
+	envListenFds = "YOGIN_LISTEN_FDS"
+	envReadyFd   = "YOGIN_READY_FD"
+
+	// restartTimeout is how long Restart waits for the new process to be ready.
+	restartTimeout = time.Minute
+)
+
+// inherited holds the listening sockets inherited from the parent process, either an
+// engine that restarted or systemd, see listenFds. They are loaded by the first Run of
+// an engine with GracefulRestart, see loadInherited.
+var inherited struct {
+	once      sync.Once
+	mu        sync.Mutex
+	listeners []*inheritedListener
+	ready     *os.File // closed by notifyReady
+}
+
+type inheritedListener struct {
+	net.Listener
+	fd    int  // the descriptor it was inherited as, see RunFd
+	taken bool // by a Run method
+}
+
+// loadInherited takes over the inherited listening sockets, and the pipe to notify the
+// engine that started the process with Restart.
+func loadInherited() {
+	inheritFds(listenFds())
+	if fd, err := strconv.Atoi(os.Getenv(envReadyFd)); err == nil {
+		inherited.ready = os.NewFile(uintptr(fd), "ready")
+		os.Unsetenv(envReadyFd)
+	}
+}
+
+// inheritedListener returns the inherited listener bound to addr on network, if the
+// engine takes over the inherited sockets, see GracefulRestart.
+func (engine *Engine) inheritedListener(network, addr string) net.Listener {
+	if !engine.GracefulRestart {
+		return nil
+	}
+	inherited.once.Do(loadInherited)
+	return takeListener(network, addr)
+}
+
+// inheritedListenerFd returns the listener inherited as fd, like inheritedListener.
+func (engine *Engine) inheritedListenerFd(fd int) (net.Listener, error) {
+	if !engine.GracefulRestart {
+		return nil, nil
+	}
+	inherited.once.Do(loadInherited)
+	return takeListenerFd(fd)
+}
+
+// listenFds returns the first file descriptor and the number of the listening sockets
+// passed by Restart, or by systemd socket activation through LISTEN_PID and LISTEN_FDS.
+// The variables it consumes are unset, so that they are not inherited by the children of
+// the process.
+func listenFds() (int, int) {
+	const first = 3 // after stdin, stdout and stderr
+	if count, err := strconv.Atoi(os.Getenv(envListenFds)); err == nil && count > 0 {
+		os.Unsetenv(envListenFds)
+		return first, count
+	}
+	if pid, err := strconv.Atoi(os.Getenv("LISTEN_PID")); err != nil || pid != os.Getpid() {
+		return first, 0
+	}
+	if count, err := strconv.Atoi(os.Getenv("LISTEN_FDS")); err == nil && count > 0 {
+		os.Unsetenv("LISTEN_PID")
+		os.Unsetenv("LISTEN_FDS")
+		return first, count
+	}
+	return first, 0
+}
+
+// takeListener returns the inherited listener bound to addr on network, if any. Each
+// listener is taken only once.
+func takeListener(network, addr string) net.Listener {
+	inherited.mu.Lock()
+	defer inherited.mu.Unlock()
+	for _, listener := range inherited.listeners {
+		if !listener.taken && listensOn(listener, network, addr) {
+			listener.taken = true
+			return listener.Listener
+		}
+	}
+	return nil
+}
+
+// takeListenerFd returns the listener inherited as fd, if any. It fails if it was already
+// taken, so that the socket is not served twice.
+func takeListenerFd(fd int) (net.Listener, error) {
+	inherited.mu.Lock()
+	defer inherited.mu.Unlock()
+	for _, listener := range inherited.listeners {
+		if listener.fd == fd {
+			if listener.taken {
+				return nil, fmt.Errorf("inherited socket %d is already served", fd)
+			}
+			listener.taken = true
+			return listener.Listener, nil
+		}
+	}
+	return nil, nil
+}
+
+// listensOn reports whether listener is bound to addr on network. Addresses without
+// an IP, such as :8080, match the sockets bound to all the interfaces.
+func listensOn(listener net.Listener, network, addr string) bool {
+	switch bound := listener.Addr().(type) {
+	case *net.TCPAddr:
+		if !strings.HasPrefix(network, "tcp") {
+			return false
+		}
+		wanted, err := net.ResolveTCPAddr(network, addr)
+		if err != nil || wanted.Port != bound.Port {
+			return false
+		}
+		if wanted.IP == nil || wanted.IP.IsUnspecified() {
+			return bound.IP.IsUnspecified()
+		}
+		return wanted.IP.Equal(bound.IP)
+	case *net.UnixAddr:
+		return network == "unix" && bound.Name == addr
+	}
+	return false
+}
+
+// notifyReady tells the engine that started the process with Restart that it can drain.
+func notifyReady() {
+	inherited.mu.Lock()
+	defer inherited.mu.Unlock()
+	if inherited.ready != nil {
+		inherited.ready.Write([]byte{1})
+		inherited.ready.Close()
+		inherited.ready = nil
+	}
+}
@@ -0,0 +1,19 @@
+//go:build !unix
+
+package yogin
+
+import (
+	"errors"
+	"os"
+)
+
+// restartSignals is empty, as the engine can only restart on Unix.
+var restartSignals []os.Signal
+
+// inheritFds does nothing, as sockets are only inherited on Unix.
+func inheritFds(first, count int) {}
+
+// Restart is only supported on Unix, see restart_unix.go.
+func (engine *Engine) Restart() error {
+	return errors.New("restart is not supported on this platform")
+}
@@ -0,0 +1,150 @@
+//go:build unix
+
+package yogin
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"syscall"
+	"time"
+)
+
+// restartSignals restart the engine with GracefulRestart, see serve.
+var restartSignals = []os.Signal{syscall.SIGUSR2, syscall.SIGHUP}
+
+// inheritFds turns the count descriptors from first that are listening sockets into
+// listeners, and closes them on exec, so that they are only passed on by Restart. The
+// other ones, e.g. datagram sockets, are left as is to the application.
+func inheritFds(first, count int) {
+	for fd := first; fd < first+count; fd++ {
+		// the socket is inspected through a duplicate, which is closed either way
+		dup, err := syscall.Dup(fd)
+		if err != nil {
+			continue
+		}
+		f := os.NewFile(uintptr(dup), fmt.Sprintf("fd@%d", fd))
+		listener, err := net.FileListener(f)
+		f.Close()
+		if err != nil {
+			continue
+		}
+		syscall.CloseOnExec(fd)
+		inherited.mu.Lock()
+		inherited.listeners = append(inherited.listeners, &inheritedListener{Listener: listener, fd: fd})
+		inherited.mu.Unlock()
+	}
+}
+
+// dupListener returns a duplicate of the socket of listener, closed on exec.
+func dupListener(listener net.Listener) (int, error) {
+	conn, ok := listener.(syscall.Conn)
+	if !ok {
+		return -1, fmt.Errorf("cannot hand off a listener of type %T", listener)
+	}
+	raw, err := conn.SyscallConn()
+	if err != nil {
+		return -1, err
+	}
+	fd, dupErr := -1, error(nil)
+	err = raw.Control(func(s uintptr) {
+		// no process is started before the duplicate is closed on exec
+		syscall.ForkLock.RLock()
+		defer syscall.ForkLock.RUnlock()
+		if fd, dupErr = syscall.Dup(int(s)); dupErr == nil {
+			syscall.CloseOnExec(fd)
+		}
+	})
+	if err != nil {
+		return -1, err
+	}
+	return fd, dupErr
+}
+
+// Restart starts a new process of the current executable with the same arguments and
+// environment, which inherits the listening sockets of the engine. With GracefulRestart,
+// the Run methods of the new process pick up the sockets bound to their address instead
+// of listening anew, so that no connection is refused during the restart.
+// Restart waits for the new process to run its OnStart hooks, and then it is up to the
+// caller to drain the engine with Shutdown. It does nothing once it succeeded.
+// With GracefulRestart, the Run methods restart and drain the engine on SIGUSR2 or SIGHUP.
+// Restart is only supported on Unix.
+func (engine *Engine) Restart() error {
+	engine.restartMu.Lock()
+	defer engine.restartMu.Unlock()
+	if engine.restarted {
+		return nil
+	}
+
+	var fds []int
+	defer func() {
+		for _, fd := range fds {
+			syscall.Close(fd)
+		}
+	}()
+	engine.serversMu.Lock()
+	for _, listener := range engine.servers {
+		fd, err := dupListener(listener)
+		if err != nil {
+			engine.serversMu.Unlock()
+			return err
+		}
+		fds = append(fds, fd)
+	}
+	engine.serversMu.Unlock()
+	if len(fds) == 0 {
+		return errors.New("no listener to hand off")
+	}
+
+	executable, err := os.Executable()
+	if err != nil {
+		return err
+	}
+	ready, readyWriter, err := os.Pipe()
+	if err != nil {
+		return err
+	}
+	defer ready.Close()
+	// the sockets are passed as is, os/exec would switch them to blocking mode through
+	// os.File.Fd, and with them the listeners of the engine
+	files := []uintptr{os.Stdin.Fd(), os.Stdout.Fd(), os.Stderr.Fd()}
+	for _, fd := range fds {
+		files = append(files, uintptr(fd))
+	}
+	files = append(files, readyWriter.Fd())
+	pid, err := syscall.ForkExec(executable, append([]string{executable}, os.Args[1:]...), &syscall.ProcAttr{
+		Env: append(os.Environ(),
+			fmt.Sprintf("%s=%d", envListenFds, len(fds)),
+			fmt.Sprintf("%s=%d", envReadyFd, 3+len(fds)),
+		),
+		Files: files,
+	})
+	readyWriter.Close()
+	if err != nil {
+		return err
+	}
+	process, err := os.FindProcess(pid)
+	if err != nil {
+		return err
+	}
+
+	ready.SetReadDeadline(time.Now().Add(restartTimeout))
+	if _, err := ready.Read(make([]byte, 1)); err != nil {
+		process.Kill()
+		process.Wait()
+		return fmt.Errorf("process %d did not get ready: %v", pid, err)
+	}
+	go process.Wait()
+
+	// the socket files are now served by the new process
+	engine.serversMu.Lock()
+	for _, listener := range engine.servers {
+		if unixListener, ok := listener.(*net.UnixListener); ok {
+			unixListener.SetUnlinkOnClose(false)
+		}
+	}
+	engine.serversMu.Unlock()
+	engine.restarted = true
+	return nil
+}
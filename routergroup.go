@@ -1,15 +1,26 @@
 package yogin
 
 import (
+	"fmt"
 	"net/http"
+	"net/url"
 	"path"
 	"strings"
 )
 
+// anyMethods are the methods registered by RouterGroup.Any.
+var anyMethods = []string{
+	http.MethodGet, http.MethodPost, http.MethodPut, http.MethodPatch,
+	http.MethodHead, http.MethodOptions, http.MethodDelete, http.MethodConnect,
+	http.MethodTrace,
+}
+
 type RouterGroup struct {
 	Handlers	HandlersChain
 	basePath	string
 	engine 		*Engine
+	host		string // empty for the default host
+	version		string // empty for all versions
 	root 		bool
 }
 
@@ -26,41 +37,123 @@ func (group *RouterGroup) Group(relativePath string, handlers ...HandlerFunc) *R
 		Handlers: group.combineHandlers(handlers),
 		basePath: group.calculateAbsolutePath(relativePath),
 		engine:   group.engine,
+		host:     group.host,
+		version:  group.version,
 	}
 }
 
-func (group *RouterGroup) handle(method, relativePath string, handlers HandlersChain) {
+// NoRoute sets the handlers called for unmatched requests under the group's base path,
+// so that e.g. /api and /web can answer 404 differently. The group's middleware runs
+// before them. On the root group it is the same as Engine.NoRoute.
+func (group *RouterGroup) NoRoute(handlers ...HandlerFunc) {
+	if group.root {
+		group.engine.NoRoute(handlers...)
+		return
+	}
+	group.engine.addGroupNoRoute(group.host, group.basePath, append(group.combineHandlers(handlers), notFoundHandler))
+}
+
+// Route is returned by the route registration methods so that the route can be named.
+type Route struct {
+	Methods []string
+	Path    string
+	engine  *Engine
+}
+
+// Name names the route so that its URL can be built with Engine.URL, or the urlFor
+// template function.
+//     router.GET("/users/:id", handler).Name("user")
+func (route *Route) Name(name string) *Route {
+	route.engine.addNamedRoute(name, route.Path)
+	return route
+}
+
+func (group *RouterGroup) handle(method, relativePath string, handlers HandlersChain) *Route {
+	return group.register(method, relativePath, handlers, false)
+}
+
+func (group *RouterGroup) register(method, relativePath string, handlers HandlersChain, replace bool) *Route {
 	absolutePath := group.calculateAbsolutePath(relativePath)
 	handlers = group.combineHandlers(handlers)
-	group.engine.addRoute(method, absolutePath, handlers)
+	group.engine.addHostRoute(group.host, group.version, method, absolutePath, handlers, replace)
+	return &Route{Methods: []string{method}, Path: absolutePath, engine: group.engine}
+}
+
+// Handle registers a new request handle and middleware with the given path and method.
+// The last handler should be the real handler, the other ones should be middleware that can and should be shared among different routes.
+// For GET, POST, PUT, PATCH and DELETE requests the respective shortcut
+// functions can be used.
+// This function is intended for bulk loading and to allow the usage of less
+// frequently used, non-standardized or custom methods (e.g. for internal
+// communication with a proxy), such as PROPFIND, REPORT or PURGE.
+func (group *RouterGroup) Handle(httpMethod, relativePath string, handlers ...HandlerFunc) *Route {
+	if !isToken(httpMethod) {
+		panic(fmt.Sprintf("http method %q is not valid", httpMethod))
+	}
+	return group.handle(httpMethod, relativePath, handlers)
+}
+
+// Replace registers a new request handle like Handle, but replaces the route registered
+// with the same method and path instead of panicking.
+// Routes can be registered, replaced and removed while the engine is serving requests,
+// e.g. by feature modules loaded at runtime. Requests being served keep the routes they
+// were matched with.
+func (group *RouterGroup) Replace(httpMethod, relativePath string, handlers ...HandlerFunc) *Route {
+	if !isToken(httpMethod) {
+		panic(fmt.Sprintf("http method %q is not valid", httpMethod))
+	}
+	return group.register(httpMethod, relativePath, handlers, true)
+}
+
+// Remove removes the route registered with the given method and path, and reports
+// whether it existed. For a route with optional params, e.g. /posts/:page?, all of its
+// variants are removed.
+func (group *RouterGroup) Remove(httpMethod, relativePath string) bool {
+	return group.engine.removeHostRoute(group.host, group.version, httpMethod, group.calculateAbsolutePath(relativePath))
 }
 
-func (group *RouterGroup) POST(relativePath string, handlers ...HandlerFunc) {
-	group.handle(http.MethodPost, relativePath, handlers)
+// Any registers a route that matches all the standard HTTP methods.
+// GET, POST, PUT, PATCH, HEAD, OPTIONS, DELETE, CONNECT, TRACE.
+func (group *RouterGroup) Any(relativePath string, handlers ...HandlerFunc) *Route {
+	return group.Match(anyMethods, relativePath, handlers...)
+}
+
+// Match registers a route that matches the specified methods that you declared.
+func (group *RouterGroup) Match(methods []string, relativePath string, handlers ...HandlerFunc) *Route {
+	assert1(len(methods) > 0, "there must be at least one method")
+	route := &Route{Path: group.calculateAbsolutePath(relativePath), engine: group.engine}
+	for _, method := range methods {
+		route.Methods = append(route.Methods, group.Handle(method, relativePath, handlers...).Methods...)
+	}
+	return route
 }
 
-func (group *RouterGroup) GET(relativePath string, handlers ...HandlerFunc) {
-	group.handle(http.MethodGet, relativePath, handlers)
+func (group *RouterGroup) POST(relativePath string, handlers ...HandlerFunc) *Route {
+	return group.handle(http.MethodPost, relativePath, handlers)
 }
 
-func (group *RouterGroup) DELETE(relativePath string, handlers ...HandlerFunc) {
-	group.handle(http.MethodDelete, relativePath, handlers)
+func (group *RouterGroup) GET(relativePath string, handlers ...HandlerFunc) *Route {
+	return group.handle(http.MethodGet, relativePath, handlers)
 }
 
-func (group *RouterGroup) PATCH(relativePath string, handlers ...HandlerFunc) {
-	group.handle(http.MethodPatch, relativePath, handlers)
+func (group *RouterGroup) DELETE(relativePath string, handlers ...HandlerFunc) *Route {
+	return group.handle(http.MethodDelete, relativePath, handlers)
 }
 
-func (group *RouterGroup) PUT(relativePath string, handlers ...HandlerFunc) {
-	group.handle(http.MethodPut, relativePath, handlers)
+func (group *RouterGroup) PATCH(relativePath string, handlers ...HandlerFunc) *Route {
+	return group.handle(http.MethodPatch, relativePath, handlers)
 }
 
-func (group *RouterGroup) OPTIONS(relativePath string, handlers ...HandlerFunc) {
-	group.handle(http.MethodOptions, relativePath, handlers)
+func (group *RouterGroup) PUT(relativePath string, handlers ...HandlerFunc) *Route {
+	return group.handle(http.MethodPut, relativePath, handlers)
 }
 
-func (group *RouterGroup) HEAD(relativePath string, handlers ...HandlerFunc) {
-	group.handle(http.MethodHead, relativePath, handlers)
+func (group *RouterGroup) OPTIONS(relativePath string, handlers ...HandlerFunc) *Route {
+	return group.handle(http.MethodOptions, relativePath, handlers)
+}
+
+func (group *RouterGroup) HEAD(relativePath string, handlers ...HandlerFunc) *Route {
+	return group.handle(http.MethodHead, relativePath, handlers)
 }
 
 func (group *RouterGroup) combineHandlers(handlers HandlersChain) HandlersChain {
@@ -75,7 +168,41 @@ func (group *RouterGroup) combineHandlers(handlers HandlersChain) HandlersChain
 
 func (group *RouterGroup) calculateAbsolutePath(relativePath string) string {
 	assert1(relativePath != "", "new group with empty relative path")
-	return path.Join(group.basePath, relativePath)
+	absolutePath := path.Join(group.basePath, relativePath)
+	// keep the trailing slash, so that /docs/ can be the canonical path of a route
+	if strings.HasSuffix(relativePath, "/") && !strings.HasSuffix(absolutePath, "/") {
+		absolutePath += "/"
+	}
+	return absolutePath
+}
+
+// Mount serves the requests for relativePath and every path under it with handler,
+// e.g. the net/http/pprof handlers, a legacy http.ServeMux, or another *Engine with its
+// own routes, templates and NoRoute handlers. The prefix is stripped from the request
+// path before handler is called, and the group's middleware runs first.
+//     admin := yogin.New()
+//     admin.GET("/users", listUsers)
+//     router.Group("/api", auth).Mount("/admin", admin) // serves /api/admin/users
+func (group *RouterGroup) Mount(relativePath string, handler http.Handler) {
+	prefixSegments := len(parseSegments(group.calculateAbsolutePath(relativePath)))
+	wrapped := WrapH(handler)
+	mounted := func(c *Context) {
+		req := c.Request
+		mountedReq := new(http.Request)
+		*mountedReq = *req
+		mountedReq.URL = new(url.URL)
+		*mountedReq.URL = *req.URL
+		mountedReq.URL.Path = stripSegments(req.URL.Path, prefixSegments)
+		if req.URL.RawPath != "" {
+			mountedReq.URL.RawPath = stripSegments(req.URL.RawPath, prefixSegments)
+		}
+
+		c.Request = mountedReq
+		wrapped(c)
+		c.Request = req
+	}
+	group.Any(relativePath, mounted)
+	group.Any(path.Join(relativePath, "/*path"), mounted)
 }
 
 // StaticFile registers a single route in order to serve a single file of the local filesystem.
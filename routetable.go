@@ -0,0 +1,133 @@
+package yogin
+
+import (
+	"fmt"
+	"sort"
+)
+
+// routeTable holds the routes of the engine. The table being served is never modified:
+// routes are added and removed on a copy which then replaces it, so that routes can be
+// registered while the engine is serving requests, and every request is routed with the
+// table it started with.
+type routeTable struct {
+	trees     methodTrees // of the default host
+	hosts     []*hostRouter
+	names     map[string]string // route name to full path
+	maxParams uint16            // capacity of the pooled Context.Params
+}
+
+func newRouteTable() *routeTable {
+	return &routeTable{
+		trees: make(methodTrees),
+		names: make(map[string]string),
+	}
+}
+
+// routes returns the route table currently served.
+func (engine *Engine) routes() *routeTable {
+	return engine.routeTable.Load().(*routeTable)
+}
+
+// updateRoutes applies update to a copy of the route table and serves the copy.
+// Updates are serialized, and if update panics the served table is left unchanged.
+func (engine *Engine) updateRoutes(update func(table *routeTable)) {
+	engine.routesMu.Lock()
+	defer engine.routesMu.Unlock()
+
+	table := engine.routes().copy()
+	update(table)
+	engine.routeTable.Store(table)
+}
+
+// copy copies the maps and the hosts slice of the table, but not the trees themselves,
+// see methodTrees.addRoute.
+func (table *routeTable) copy() *routeTable {
+	c := *table
+	c.trees = table.trees.copy()
+	c.hosts = append([]*hostRouter(nil), table.hosts...)
+	c.names = make(map[string]string, len(table.names))
+	for name, path := range table.names {
+		c.names[name] = path
+	}
+	return &c
+}
+
+func (trees methodTrees) copy() methodTrees {
+	c := make(methodTrees, len(trees))
+	for method, tree := range trees {
+		c[method] = tree
+	}
+	return c
+}
+
+// eachTree calls fn with each method tree of the default host, and then of each host in
+// matching order. The trees of a host are passed in alphabetical order of their method.
+func (table *routeTable) eachTree(fn func(host string, tree methodTree)) {
+	table.trees.each("", fn)
+	for _, router := range table.hosts {
+		router.trees.each(router.host, fn)
+	}
+}
+
+func (trees methodTrees) each(host string, fn func(host string, tree methodTree)) {
+	methods := make([]string, 0, len(trees))
+	for method := range trees {
+		methods = append(methods, method)
+	}
+	sort.Strings(methods)
+
+	for _, method := range methods {
+		fn(host, trees[method])
+	}
+}
+
+// hostTrees returns the trees of host, or of the default host if host is empty, along
+// with the number of params of the host. The trees of a host are copied before being
+// returned, and can be modified.
+func (table *routeTable) hostTrees(host string) (methodTrees, uint16) {
+	if host == "" {
+		return table.trees, 0
+	}
+	for i, router := range table.hosts {
+		if router.host == host {
+			c := *router
+			c.trees = router.trees.copy()
+			table.hosts[i] = &c
+			return c.trees, uint16(len(c.pattern.keys()))
+		}
+	}
+	panic(fmt.Sprintf("host %s is not registered", host))
+}
+
+func (table *routeTable) addRoute(host, version, method, path string, handlers HandlersChain) {
+	trees, paramsCount := table.hostTrees(host)
+	if paramsCount += trees.addRoute(method, path, version, handlers); paramsCount > table.maxParams {
+		table.maxParams = paramsCount
+	}
+}
+
+func (table *routeTable) removeRoute(host, version, method, path string) bool {
+	trees, _ := table.hostTrees(host)
+	if !trees.removeRoute(method, path, version) {
+		return false
+	}
+	// the names of the path are dropped with its last route, so that URL fails
+	if !table.serves(path) {
+		for name, namedPath := range table.names {
+			if namedPath == path {
+				delete(table.names, name)
+			}
+		}
+	}
+	return true
+}
+
+// serves reports whether a route of any method and host has the given path.
+func (table *routeTable) serves(path string) (found bool) {
+	table.eachTree(func(host string, tree methodTree) {
+		for _, route := range iterate(host, tree.method, nil, tree.root) {
+			found = found || route.Path == path
+		}
+	})
+	return found
+}
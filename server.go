@@ -0,0 +1,314 @@
+package yogin
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+// OnStart registers hooks run by the first Run method once the engine is listening, before
+// serving the first request. They are run once until the engine is shut down, like the
+// OnShutdown hooks, and the later Run calls wait for them. If a hook fails, the Run
+// methods waiting for them stop listening and return its error.
+func (engine *Engine) OnStart(hooks ...func() error) {
+	engine.onStart = append(engine.onStart, hooks...)
+}
+
+// OnShutdown registers hooks run by Shutdown once the servers are stopped, e.g. to flush
+// the logs or close the session stores. They get the context of Shutdown, so that they
+// can respect its deadline.
+func (engine *Engine) OnShutdown(hooks ...func(ctx context.Context) error) {
+	engine.onShutdown = append(engine.onShutdown, hooks...)
+}
+
+// RunWithContext listens on the TCP network address addr and serves HTTP requests until
+// ctx is done or the process receives SIGINT or SIGTERM. It then stops accepting
+// connections and calls Shutdown, which waits up to ShutdownTimeout for the in-flight
+// requests to finish.
+// It returns once the engine is shut down, with the result of Shutdown, even if it was
+// called directly or by another Run method, or with the error that stopped it.
+// With GracefulRestart, if the process inherited a listening socket bound to addr, from
+// Restart or systemd socket activation, the engine serves it instead of listening anew.
+func (engine *Engine) RunWithContext(ctx context.Context, addr string) error {
+	listener, err := engine.listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	return engine.serve(ctx, listener, func(server *http.Server, listener net.Listener) error {
+		return server.Serve(listener)
+	})
+}
+
+// RunTLS attaches the router to a http.Server and starts listening and serving HTTPS
+// (secure) requests on addr, with the certificate and matching private key of the given
+// files, see GenerateDevCert for local development. It returns like RunWithContext.
+func (engine *Engine) RunTLS(addr, certFile, keyFile string) error {
+	listener, err := engine.listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	return engine.serve(context.Background(), listener, func(server *http.Server, listener net.Listener) error {
+		return server.ServeTLS(listener, certFile, keyFile)
+	})
+}
+
+// RunUnix attaches the router to a http.Server and starts listening and serving HTTP
+// requests through the Unix socket file, e.g. behind nginx. A stale socket file left by
+// a previous run is replaced, but not a socket still in use nor any other kind of file.
+// The socket gets the permissions of UnixSocketMode if set, and is removed once the
+// engine is shut down. It returns like RunWithContext. With GracefulRestart, it serves
+// the inherited socket bound to file instead, which is removed at shutdown as well.
+func (engine *Engine) RunUnix(file string) error {
+	listener := engine.inheritedListener("unix", file)
+	if unixListener, ok := listener.(*net.UnixListener); ok {
+		// net.FileListener leaves the file of the inherited socket in place
+		unixListener.SetUnlinkOnClose(true)
+	} else {
+		if err := removeStaleSocket(file); err != nil {
+			return err
+		}
+		var err error
+		listener, err = net.Listen("unix", file)
+		if err != nil {
+			return err
+		}
+		if engine.UnixSocketMode != 0 {
+			if err := setSocketMode(listener.(*net.UnixListener), file, engine.UnixSocketMode); err != nil {
+				listener.Close()
+				return err
+			}
+		}
+	}
+	return engine.serve(context.Background(), listener, func(server *http.Server, listener net.Listener) error {
+		return server.Serve(listener)
+	})
+}
+
+// listen returns the inherited listener bound to addr, or announces on the local address.
+func (engine *Engine) listen(network, addr string) (net.Listener, error) {
+	if listener := engine.inheritedListener(network, addr); listener != nil {
+		return listener, nil
+	}
+	return net.Listen(network, addr)
+}
+
+func removeStaleSocket(file string) error {
+	info, err := os.Lstat(file)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if info.Mode()&os.ModeSocket == 0 {
+		return fmt.Errorf("%s already exists and is not a socket", file)
+	}
+	if conn, err := net.Dial("unix", file); err == nil {
+		conn.Close()
+		return fmt.Errorf("socket %s is already in use", file)
+	}
+	return os.Remove(file)
+}
+
+// RunListener attaches the router to a http.Server and starts serving HTTP requests
+// through the specified net.Listener, which is closed once the engine is shut down.
+// It returns like RunWithContext.
+func (engine *Engine) RunListener(listener net.Listener) error {
+	return engine.serve(context.Background(), listener, func(server *http.Server, listener net.Listener) error {
+		return server.Serve(listener)
+	})
+}
+
+// RunFd attaches the router to a http.Server and starts serving HTTP requests through
+// the listening socket of the file descriptor fd, e.g. inherited from the parent process.
+// It returns like RunWithContext. The sockets of systemd socket activation start at fd 3.
+// With GracefulRestart, the inherited sockets are taken over by the first Run method:
+// RunFd serves the one inherited as fd, and fails if another Run method already picked
+// it up by its address.
+func (engine *Engine) RunFd(fd int) error {
+	listener, err := engine.inheritedListenerFd(fd)
+	if err != nil {
+		return err
+	}
+	if listener != nil {
+		return engine.RunListener(listener)
+	}
+	f := os.NewFile(uintptr(fd), fmt.Sprintf("fd@%d", fd))
+	if f == nil {
+		return fmt.Errorf("invalid file descriptor %d", fd)
+	}
+	listener, err = net.FileListener(f)
+	f.Close()
+	if err != nil {
+		return err
+	}
+	return engine.RunListener(listener)
+}
+
+// Shutdown gracefully stops the servers started by the Run methods: they stop accepting
+// connections, and Shutdown waits for the in-flight requests to finish or ctx to be done.
+// Then the OnShutdown hooks are run, once for all the servers. It returns the first
+// error met.
+// If no server was started since, further or concurrent calls wait for the same shutdown,
+// or ctx to be done, and return its result.
+func (engine *Engine) Shutdown(ctx context.Context) error {
+	engine.serversMu.Lock()
+	if len(engine.servers) == 0 {
+		shutdown := engine.shutdown
+		engine.serversMu.Unlock()
+		if shutdown == nil {
+			return nil
+		}
+		return shutdown.wait(ctx)
+	}
+	servers := engine.servers
+	shutdown := &shutdown{done: make(chan struct{})}
+	engine.servers = make(map[*http.Server]net.Listener)
+	engine.shutdown = shutdown
+	engine.start = nil
+	engine.serversMu.Unlock()
+	defer close(shutdown.done)
+
+	// all the servers stop accepting connections at once, and then drain
+	errs := make(chan error, len(servers))
+	for server := range servers {
+		go func(server *http.Server) {
+			errs <- server.Shutdown(ctx)
+		}(server)
+	}
+	for range servers {
+		if err := <-errs; err != nil && shutdown.err == nil {
+			shutdown.err = err
+		}
+	}
+	for _, hook := range engine.onShutdown {
+		if err := hook(ctx); err != nil && shutdown.err == nil {
+			shutdown.err = err
+		}
+	}
+	return shutdown.err
+}
+
+// startup is the result of the OnStart hooks, available once done is closed.
+type startup struct {
+	done chan struct{}
+	err  error
+}
+
+// shutdown is the result of a call to Shutdown, available once done is closed.
+type shutdown struct {
+	done chan struct{}
+	err  error
+}
+
+func (s *shutdown) wait(ctx context.Context) error {
+	select {
+	case <-s.done:
+		return s.err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// serve runs the OnStart hooks and serves the requests received by listener with run,
+// until the engine is shut down, see RunWithContext. The listener given to run accepts
+// the PROXY protocol if enabled, see UseProxyProtocol.
+func (engine *Engine) serve(ctx context.Context, listener net.Listener, run func(*http.Server, net.Listener) error) error {
+	defer listener.Close()
+	server := &http.Server{Handler: engine}
+	engine.serversMu.Lock()
+	engine.servers[server] = listener
+	start, first := engine.start, engine.start == nil
+	if first {
+		start = &startup{done: make(chan struct{})}
+		engine.start = start
+	}
+	engine.serversMu.Unlock()
+	if engine.proxyUpstreams != nil {
+		listener = &proxyProtocolListener{Listener: listener, upstreams: *engine.proxyUpstreams}
+	}
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	if engine.GracefulRestart && len(restartSignals) > 0 {
+		signal.Notify(signals, restartSignals...)
+	}
+	defer signal.Stop(signals)
+
+	if first {
+		for _, hook := range engine.onStart {
+			if start.err = hook(); start.err != nil {
+				break
+			}
+		}
+		if start.err != nil {
+			// the next Run call starts the engine again
+			engine.serversMu.Lock()
+			if engine.start == start {
+				engine.start = nil
+			}
+			engine.serversMu.Unlock()
+		}
+		close(start.done)
+	}
+	<-start.done
+	if start.err != nil {
+		engine.removeServer(server)
+		return start.err
+	}
+
+	errs := make(chan error, 1)
+	go func() {
+		errs <- run(server, listener)
+	}()
+	notifyReady()
+
+wait:
+	for {
+		select {
+		case err := <-errs:
+			if err == http.ErrServerClosed {
+				// stopped by Shutdown, which may still be draining the other servers
+				engine.serversMu.Lock()
+				shutdown := engine.shutdown
+				engine.serversMu.Unlock()
+				return shutdown.wait(context.Background())
+			}
+			engine.removeServer(server)
+			return err
+		case <-ctx.Done():
+			break wait
+		case sig := <-signals:
+			if isRestartSignal(sig) {
+				if err := engine.Restart(); err != nil {
+					fmt.Fprintf(DefaultErrorWriter, "[YOGIN] restart failed: %v\n", err)
+					continue
+				}
+			}
+			break wait
+		}
+	}
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), engine.ShutdownTimeout)
+	defer cancel()
+	return engine.Shutdown(shutdownCtx)
+}
+
+func isRestartSignal(sig os.Signal) bool {
+	for _, restart := range restartSignals {
+		if sig == restart {
+			return true
+		}
+	}
+	return false
+}
+
+func (engine *Engine) removeServer(server *http.Server) {
+	engine.serversMu.Lock()
+	defer engine.serversMu.Unlock()
+	delete(engine.servers, server)
+}
@@ -0,0 +1,13 @@
+//go:build !unix
+
+package yogin
+
+import (
+	"net"
+	"os"
+)
+
+// setSocketMode does nothing, as the permissions of Unix sockets only apply on Unix.
+func setSocketMode(listener *net.UnixListener, file string, mode os.FileMode) error {
+	return nil
+}
@@ -0,0 +1,47 @@
+//go:build unix
+
+package yogin
+
+import (
+	"net"
+	"os"
+	"syscall"
+)
+
+// setSocketMode changes the permissions of the socket file listener is bound to. The
+// peers that connected with the permissions of the umask are dropped.
+func setSocketMode(listener *net.UnixListener, file string, mode os.FileMode) error {
+	if err := os.Chmod(file, mode); err != nil {
+		return err
+	}
+	return closePending(listener)
+}
+
+// closePending closes the connections waiting to be accepted by listener.
+func closePending(listener *net.UnixListener) error {
+	raw, err := listener.SyscallConn()
+	if err != nil {
+		return err
+	}
+	// the socket is nonblocking, accept fails with EAGAIN once the queue is empty
+	var acceptErr error
+	err = raw.Control(func(fd uintptr) {
+		for {
+			conn, _, err := syscall.Accept(int(fd))
+			switch err {
+			case nil:
+				syscall.Close(conn)
+			case syscall.EINTR, syscall.ECONNABORTED:
+			case syscall.EAGAIN:
+				return
+			default:
+				acceptErr = err
+				return
+			}
+		}
+	})
+	if err != nil {
+		return err
+	}
+	return acceptErr
+}
@@ -3,16 +3,23 @@ package yogin
 import (
 	"fmt"
 	"path"
+	"regexp"
 	"strings"
 )
 
 type node struct {
-	segment   string
-	handlers  HandlersChain
-	children  []*node
-	wildChild *node	// at most one :param or *catchAll style child
-	path      string
-	fullPath  string
+	segment       string
+	handlers      HandlersChain
+	children      []*node
+	wildChildren  []*node                  // :param style children, at most one per pattern shape, most specific first
+	catchAllChild *node                    // at most one *catchAll style child, tried after all other children
+	pattern       *segmentPattern          // of :param style nodes
+	key           string                   // param name of *catchAll style nodes
+	defaults      Params                   // values of the optional params left out of the route
+	shortened     bool                     // the route is registered without its optional params
+	versions      map[string]HandlersChain // handlers of the route per version, see RouterGroup.Version
+	path          string
+	fullPath      string
 }
 
 type Param struct {
@@ -37,93 +44,265 @@ func (ps Params) ByName(name string) (va string) {
 }
 
 type nodeValue struct {
-	handlers	HandlersChain
-	params 		Params
-	fullPath	string
+	handlers HandlersChain
+	fullPath string
 }
 
-func (n *node) insertChild(segments []string, level int, fullPath string, handlers HandlersChain) {
+func (n *node) insertChild(segments []string, level int, fullPath, version string, handlers HandlersChain, defaults Params) {
 	if len(segments) == level {
-		if n.fullPath != "" {
+		if n.fullPath != "" && (version == "" || n.versions == nil || n.fullPath != fullPath) {
 			panic(fmt.Sprintf("new route %s conflicts with existing route %s", fullPath, n.fullPath))
 		}
+		if version != "" {
+			if _, ok := n.versions[version]; ok {
+				panic(fmt.Sprintf("new route %s conflicts with existing route %s of version %s", fullPath, n.fullPath, version))
+			}
+			n.versions = withVersion(n.versions, version, handlers)
+			handlers = HandlersChain{versionHandler(n.versions)}
+		}
 		n.fullPath = fullPath
 		n.handlers = handlers
+		n.defaults = defaults
+		n.shortened = len(segments) < len(parseSegments(fullPath))
 		return
 	}
 
 	segment := segments[level]
 
-	if isCatchAll(segment) && len(n.children) > 0 {
-		panic(fmt.Sprintf("catch-all conflicts with existing handle for the path segment root in path %s", fullPath))
+	if isCatchAll(segment) && level+1 != len(segments) {
+		panic(fmt.Sprintf("catch-all routes are only allowed at the end of the path %v", fullPath))
+	}
+
+	var pattern *segmentPattern
+	if isParam(segment) {
+		pattern = parsePattern(segment, fullPath)
+		if wildChild := n.matchWildChild(pattern); wildChild != nil && wildChild.segment != segment {
+			panic(fmt.Sprintf("%s in new path %s conflicts with existing wildcard %s in existing prefix %s", segment, fullPath, wildChild.segment, wildChild.path))
+		}
 	}
 
-	if isWild(segment) && n.wildChild != nil && n.wildChild.segment != segment {
-		panic(fmt.Sprintf("%s in new path %s conflicts with existing wildcard %s in existing prefix %s", segment, fullPath, n.wildChild.segment, n.wildChild.path))
+	if isCatchAll(segment) && n.catchAllChild != nil && n.catchAllChild.segment != segment {
+		panic(fmt.Sprintf("%s in new path %s conflicts with existing catch-all %s in existing prefix %s", segment, fullPath, n.catchAllChild.segment, n.catchAllChild.path))
 	}
 
-	child := n.matchChild(segment)
-	isWild := isWild(segment)
+	child := n.matchChild(segment, pattern)
 
 	// create new node
 	if child == nil {
 		child = &node{segment: segment, path: path.Join(n.path, segment)}
-		if isWild {
-			n.wildChild = child
-		} else {
+		switch {
+		case isCatchAll(segment):
+			child.key = segment[1:]
+			n.catchAllChild = child
+		case isParam(segment):
+			child.pattern = pattern
+			n.addWildChild(child)
+		default:
 			n.children = append(n.children, child)
 		}
+	} else {
+		child = n.copyChild(child)
 	}
 
-	if isCatchAll(segment) && level+1 != len(segments) {
-		panic(fmt.Sprintf("catch-all routes are only allowed at the end of the path %v", fullPath))
+	child.insertChild(segments, level+1, fullPath, version, handlers, defaults)
+}
+
+// removeChild clears the node of fullPath, and prunes the nodes left without
+// handlers nor children. If version is not empty, only the handlers of that version
+// are removed. It reports whether the node was found.
+func (n *node) removeChild(segments []string, level int, fullPath, version string) bool {
+	if len(segments) == level {
+		if n.fullPath != fullPath {
+			return false
+		}
+		if version != "" {
+			if _, ok := n.versions[version]; !ok {
+				return false
+			}
+			if len(n.versions) > 1 {
+				n.versions = withoutVersion(n.versions, version)
+				n.handlers = HandlersChain{versionHandler(n.versions)}
+				return true
+			}
+		}
+		n.handlers, n.versions, n.defaults, n.shortened, n.fullPath = nil, nil, nil, false, ""
+		return true
+	}
+
+	segment := segments[level]
+	var pattern *segmentPattern
+	if isParam(segment) {
+		pattern = parsePattern(segment, fullPath)
+	}
+	child := n.matchChild(segment, pattern)
+	if child == nil {
+		return false
+	}
+	child = n.copyChild(child)
+	if !child.removeChild(segments, level+1, fullPath, version) {
+		return false
 	}
 
-	child.insertChild(segments, level+1, fullPath, handlers)
+	if child.isEmpty() {
+		switch {
+		case child == n.catchAllChild:
+			n.catchAllChild = nil
+		case child.pattern != nil:
+			n.wildChildren = removeNode(n.wildChildren, child)
+		default:
+			n.children = removeNode(n.children, child)
+		}
+	}
+	return true
+}
+
+func (n *node) isEmpty() bool {
+	return n.handlers == nil && len(n.children) == 0 && len(n.wildChildren) == 0 && n.catchAllChild == nil
 }
 
-func (n *node) matchChild(segment string) *node {
+func removeNode(nodes []*node, n *node) []*node {
+	i := indexOfNode(nodes, n)
+	return append(nodes[:i], nodes[i+1:]...)
+}
+
+// copy returns a shallow copy of n whose child slices can be modified. The trees being
+// served are never modified: a route is added or removed by copying the nodes along
+// its path, which share the rest of the tree with the served one.
+func (n *node) copy() *node {
+	c := *n
+	c.children = append([]*node(nil), n.children...)
+	c.wildChildren = append([]*node(nil), n.wildChildren...)
+	return &c
+}
+
+// copyChild replaces child by a copy of it in n, which must be a copy itself.
+func (n *node) copyChild(child *node) *node {
+	c := child.copy()
+	switch {
+	case child == n.catchAllChild:
+		n.catchAllChild = c
+	case child.pattern != nil:
+		n.wildChildren[indexOfNode(n.wildChildren, child)] = c
+	default:
+		n.children[indexOfNode(n.children, child)] = c
+	}
+	return c
+}
+
+func indexOfNode(nodes []*node, n *node) int {
+	for i, child := range nodes {
+		if child == n {
+			return i
+		}
+	}
+	return -1
+}
+
+func (n *node) matchChild(segment string, pattern *segmentPattern) *node {
 	// let the caller judge if there is conflict
-	if isCatchAll(segment) || isParam(segment) {
-		if n.wildChild != nil && n.wildChild.segment != segment {
-			panic("conflict")
+	switch {
+	case isCatchAll(segment):
+		return n.catchAllChild
+	case isParam(segment):
+		if wildChild := n.matchWildChild(pattern); wildChild != nil && wildChild.segment == segment {
+			return wildChild
 		}
-		return n.wildChild
+		return nil
 	}
-	for _, child := range n.children {
-		if child.segment == segment {
+	return n.matchLiteralChild(segment)
+}
+
+// matchWildChild returns the :param style child with the same shape as pattern,
+// i.e. the same literals and constraints.
+func (n *node) matchWildChild(pattern *segmentPattern) *node {
+	for _, child := range n.wildChildren {
+		if child.pattern.shape == pattern.shape {
 			return child
 		}
 	}
-
 	return nil
 }
 
-func (n *node) getValue(segments []string, level int) *node {
-	if len(segments) == level || strings.HasPrefix(n.segment, "*") {
-		if n.handlers == nil {
-			return nil
-		}
-		return n
+// addWildChild keeps the wildChildren ordered from the most specific pattern to the
+// least, so that e.g. :id<int>.json is tried before :name.:ext, and :name last.
+func (n *node) addWildChild(child *node) {
+	i := len(n.wildChildren)
+	for i > 0 && child.pattern.moreSpecific(n.wildChildren[i-1].pattern) {
+		i--
 	}
+	n.wildChildren = append(n.wildChildren, nil)
+	copy(n.wildChildren[i+1:], n.wildChildren[i:])
+	n.wildChildren[i] = child
+}
 
-	segment := segments[level]
-	child := n.matchChildAndWild(segment)
-	if child == nil {
+// getValue walks path segment by segment without splitting it. It tries the string
+// literal child first, and backtracks to the wildChildren whose pattern matches the
+// segment, and then to the catchAllChild if the branch dead-ends deeper down. The
+// catchAllChild also matches an empty remainder, e.g. / for /*filepath.
+// The values of :param and *catchAll segments are appended to params and dropped
+// again when backtracking.
+// If ignoreCase is true, the literal children differing in case are tried in turn after
+// the exact one, before the wildChildren.
+func (n *node) getValue(path string, params *Params, ignoreCase bool) *node {
+	segment, rest := nextSegment(path)
+	if segment == "" {
+		if n.handlers != nil {
+			*params = append(*params, n.defaults...)
+			return n
+		}
+		if child := n.catchAllChild; child != nil && child.handlers != nil {
+			if child.key != "" {
+				*params = append(*params, Param{child.key, ""})
+			}
+			return child
+		}
 		return nil
 	}
 
-	return child.getValue(segments, level+1)
+	exact := n.matchLiteralChild(segment)
+	if exact != nil {
+		if found := exact.getValue(rest, params, ignoreCase); found != nil {
+			return found
+		}
+	}
+	if ignoreCase {
+		for _, child := range n.children {
+			if child == exact || !strings.EqualFold(child.segment, segment) {
+				continue
+			}
+			mark := len(*params)
+			if found := child.getValue(rest, params, ignoreCase); found != nil {
+				return found
+			}
+			*params = (*params)[:mark]
+		}
+	}
+	for _, child := range n.wildChildren {
+		mark := len(*params)
+		if !child.pattern.match(segment, params) {
+			continue
+		}
+		if found := child.getValue(rest, params, ignoreCase); found != nil {
+			return found
+		}
+		*params = (*params)[:mark]
+	}
+	if child := n.catchAllChild; child != nil && child.handlers != nil {
+		if child.key != "" {
+			*params = append(*params, Param{child.key, strings.Trim(path, "/")})
+		}
+		return child
+	}
+	return nil
 }
 
-func (n *node) matchChildAndWild(segment string) *node {
+func (n *node) matchLiteralChild(segment string) *node {
 	for _, child := range n.children {
 		if child.segment == segment {
 			return child
 		}
 	}
-	// if no string literal child, return wildChild (which can also be nil)
-	return n.wildChild
+	return nil
 }
 
 type methodTree struct {
@@ -131,35 +310,295 @@ type methodTree struct {
 	root 	*node
 }
 
-// addRoute allows at most one :param or *catchAll style segment at each position
+type methodTrees map[string]methodTree
+
+// addRoute adds the route to the tree of method, creating it if needed.
+// The nodes along the route are copied rather than modified, so trees must be a copy
+// of the served methodTrees, see routeTable.
+// The tree of method is printed along with the panic of a conflicting route.
+// It returns the number of params of the route.
+func (trees methodTrees) addRoute(method, path, version string, handlers HandlersChain) uint16 {
+	defer func() {
+		if err := recover(); err != nil {
+			if tree, ok := trees[method]; ok {
+				var b strings.Builder
+				tree.print(&b, "")
+				err = fmt.Sprintf("%v\n\n%s", err, b.String())
+			}
+			panic(err)
+		}
+	}()
+
+	tree, ok := trees[method]
+	if ok {
+		tree.root = tree.root.copy()
+	} else {
+		tree = methodTree{method, &node{path: "/"}}
+	}
+	paramsCount := tree.addRoute(path, version, handlers)
+	trees[method] = tree
+	return paramsCount
+}
+
+// removeRoute removes the route from the tree of method, and the tree itself once it
+// is empty. Like addRoute, it copies the nodes along the route.
+// It reports whether the route was registered.
+func (trees methodTrees) removeRoute(method, path, version string) bool {
+	tree, ok := trees[method]
+	if !ok {
+		return false
+	}
+	tree.root = tree.root.copy()
+	if !tree.removeRoute(path, version) {
+		return false
+	}
+	if tree.root.isEmpty() {
+		delete(trees, method)
+	} else {
+		trees[method] = tree
+	}
+	return true
+}
+
+// addRoute allows at most one :param style segment per shape and one *catchAll
+// style segment at each position
 // *catchAll should only appears at the end of the route
-func (t *methodTree) addRoute(path string, handlers HandlersChain) {
-	segments := parseSegments(path)
-	t.root.insertChild(segments, 0, path, handlers)
+// Trailing :param? and :param=default segments are optional, the route is registered
+// once with each of them and once without, e.g. /posts and /posts/:page for
+// /posts/:page=1, where the latter gets page "1" as param.
+// It returns the number of params of the route.
+func (t *methodTree) addRoute(path, version string, handlers HandlersChain) (paramsCount uint16) {
+	for _, route := range expandRoute(path) {
+		t.root.insertChild(route.segments, 0, path, version, handlers, route.defaults)
+		paramsCount = countParams(route.segments, path)
+	}
+	return paramsCount
 }
 
-// getRoute always tries to match string literal first
-// E.g. If /:hello/world and /hello/:world both exist, for URL /hello/world,
-// it will match /hello/:world
-func (t *methodTree) getRoute(path string) (value nodeValue) {
+// removeRoute removes every node registered for path, see addRoute.
+func (t *methodTree) removeRoute(path, version string) bool {
+	removed := false
+	for _, route := range expandRoute(path) {
+		if t.root.removeChild(route.segments, 0, path, version) {
+			removed = true
+		}
+	}
+	return removed
+}
+
+// expandedRoute is one of the registrations of a route with optional params.
+type expandedRoute struct {
+	segments []string
+	defaults Params
+}
+
+// expandRoute returns the registrations of path, from the one without any of its
+// trailing optional params to the one with all of them.
+func expandRoute(path string) []expandedRoute {
 	segments := parseSegments(path)
-	n := t.root.getValue(segments, 0)
+	required := len(segments)
+	for required > 0 && isOptionalParam(segments[required-1]) {
+		required--
+	}
+	for _, segment := range segments[:required] {
+		if isOptionalParam(segment) {
+			panic(fmt.Sprintf("optional params are only allowed at the end of the path %s", path))
+		}
+	}
+
+	optional := make([]optionalParam, 0, len(segments)-required)
+	for _, segment := range segments[required:] {
+		optional = append(optional, parseOptionalParam(segment, path))
+	}
+
+	routes := make([]expandedRoute, 0, len(optional)+1)
+	for i := 0; i <= len(optional); i++ {
+		route := expandedRoute{segments: make([]string, 0, required+i)}
+		route.segments = append(route.segments, segments[:required]...)
+		for _, param := range optional[:i] {
+			route.segments = append(route.segments, param.segment)
+		}
+		for _, param := range optional[i:] {
+			if param.hasDefault {
+				route.defaults = append(route.defaults, Param{param.key, param.value})
+			}
+		}
+		routes = append(routes, route)
+	}
+	return routes
+}
+
+// optionalParam is a :param? or :param=default segment.
+type optionalParam struct {
+	segment    string // without the ? or =default suffix
+	key        string
+	value      string
+	hasDefault bool
+}
+
+func isOptionalParam(segment string) bool {
+	_, ok := splitOptionalParam(segment)
+	return ok
+}
 
-	if n != nil {
+// splitOptionalParam returns the length of the :param or :param<constraint> prefix of
+// an optional segment.
+func splitOptionalParam(segment string) (int, bool) {
+	if !strings.HasPrefix(segment, ":") {
+		return 0, false
+	}
+	i := 1
+	for i < len(segment) && isParamNameByte(segment[i]) {
+		i++
+	}
+	if i > 1 && i < len(segment) && segment[i] == '<' {
+		end := constraintEnd(segment[i:])
+		if end < 0 {
+			return 0, false
+		}
+		i += end + 1
+	}
+	if i == 1 || i == len(segment) {
+		return 0, false
+	}
+	return i, segment[i:] == "?" || segment[i] == '='
+}
+
+func parseOptionalParam(segment, fullPath string) optionalParam {
+	i, _ := splitOptionalParam(segment)
+	part := parsePattern(segment[:i], fullPath).parts[0]
+	param := optionalParam{segment: segment[:i], key: part.key}
+	if segment[i] == '=' {
+		param.value, param.hasDefault = segment[i+1:], true
+		if part.accept != nil && !part.accept(param.value) {
+			panic(fmt.Sprintf("default value %s of param %s does not satisfy <%s> in path %s", param.value, part.key, part.constraint, fullPath))
+		}
+	}
+	return param
+}
+
+// getRoute always tries to match string literal first, and falls back to the
+// :param and then to the *catchAll segment at the same position if the branch fails.
+// Constrained params such as :id<int> and params mixed with literals such as :name.:ext
+// are tried before the bare :param, and are skipped if the segment does not match them.
+// E.g. If /:hello/world and /hello/:world both exist, for URL /hello/world,
+// it will match /hello/:world.
+// If /hello/world/x and /:hello/world/y both exist, for URL /hello/world/y,
+// the literal branch dead-ends and it will match /:hello/world/y.
+// The param values are appended to params, which is usually the pooled Context.Params,
+// so that static and param routes are looked up without any allocation.
+func (t *methodTree) getRoute(path string, params *Params, ignoreCase bool) (value nodeValue) {
+	if n := t.root.getValue(path, params, ignoreCase); n != nil {
 		value.handlers = n.handlers
 		value.fullPath = n.fullPath
+	}
+	return
+}
+
+// findCaseInsensitivePath looks up the cleaned path ignoring the case of string literal
+// segments, and returns it rewritten in the canonical form of the route it matches.
+func (t *methodTree) findCaseInsensitivePath(p string) (string, bool) {
+	segments := parseSegments(path.Clean("/" + p))
+	fixed := make([]string, len(segments))
+	n := t.root.findCaseInsensitive(segments, 0, fixed)
+	if n == nil {
+		return "", false
+	}
+	return canonicalPath("/"+strings.Join(fixed, "/"), n.fullPath), true
+}
 
-		patterns := parseSegments(n.fullPath)
-		value.params = make(Params, 0)
-		for index, pattern := range patterns {
-			if pattern[0] == ':' {
-				value.params = append(value.params, Param{pattern[1:], segments[index]})
-			} else if pattern[0] == '*' && len(pattern) > 1 {
-				value.params = append(value.params, Param{pattern[1:], strings.Join(segments[index:], "/")})
+func (n *node) findCaseInsensitive(segments []string, level int, fixed []string) *node {
+	if len(segments) == level || isCatchAll(n.segment) {
+		if n.handlers != nil {
+			copy(fixed[level:], segments[level:])
+			return n
+		}
+		// the catchAllChild matches an empty remainder, as in getValue
+		if child := n.catchAllChild; len(segments) == level && child != nil && child.handlers != nil {
+			return child
+		}
+		return nil
+	}
+
+	segment := segments[level]
+	for _, child := range n.children {
+		if strings.EqualFold(child.segment, segment) {
+			fixed[level] = child.segment
+			if found := child.findCaseInsensitive(segments, level+1, fixed); found != nil {
+				return found
 			}
 		}
 	}
-	return
+	var params Params
+	for _, child := range n.wildChildren {
+		if child.pattern.match(segment, &params) {
+			fixed[level] = segment
+			if found := child.findCaseInsensitive(segments, level+1, fixed); found != nil {
+				return found
+			}
+		}
+	}
+	if n.catchAllChild != nil {
+		fixed[level] = segment
+		return n.catchAllChild.findCaseInsensitive(segments, level+1, fixed)
+	}
+	return nil
+}
+
+// canonicalPath returns path without empty segments, ending with a slash only if the
+// route fullPath does. Routes ending with a catch-all keep the trailing slash of path.
+func canonicalPath(p, fullPath string) string {
+	trailingSlash := strings.HasSuffix(fullPath, "/")
+	if isCatchAll(lastSegment(fullPath)) {
+		trailingSlash = strings.HasSuffix(p, "/")
+	}
+	// fast path, p is already canonical
+	if strings.HasPrefix(p, "/") && !strings.Contains(p, "//") && (p == "/" || strings.HasSuffix(p, "/") == trailingSlash) {
+		return p
+	}
+
+	canonical := "/" + strings.Join(parseSegments(p), "/")
+	if canonical != "/" && trailingSlash {
+		canonical += "/"
+	}
+	return canonical
+}
+
+// nextSegment returns the first non-empty segment of path and the rest of path after it.
+func nextSegment(path string) (segment, rest string) {
+	for len(path) > 0 && path[0] == '/' {
+		path = path[1:]
+	}
+	if end := strings.IndexByte(path, '/'); end >= 0 {
+		return path[:end], path[end:]
+	}
+	return path, ""
+}
+
+// stripSegments removes the first n segments of path, keeping its trailing slash.
+func stripSegments(path string, n int) string {
+	for ; n > 0; n-- {
+		_, path = nextSegment(path)
+	}
+	return "/" + strings.TrimLeft(path, "/")
+}
+
+func lastSegment(path string) string {
+	path = strings.TrimRight(path, "/")
+	return path[strings.LastIndexByte(path, '/')+1:]
+}
+
+func countParams(segments []string, fullPath string) uint16 {
+	var n uint16
+	for _, segment := range segments {
+		switch {
+		case isCatchAll(segment):
+			n++
+		case isParam(segment):
+			n += uint16(len(parsePattern(segment, fullPath).keys()))
+		}
+	}
+	return n
 }
 
 func parseSegments(path string) []string {
@@ -174,12 +613,247 @@ func parseSegments(path string) []string {
 	return segments
 }
 
+// segmentPattern is a :param style segment, made of string literals and params that
+// may be constrained, e.g. :id<int>, :name.:ext or v:version.
+type segmentPattern struct {
+	parts []patternPart
+	shape string // the segment without param names, patterns of the same shape conflict
+}
+
+type patternPart struct {
+	literal    string
+	key        string // param name, empty for string literal parts
+	constraint string // e.g. int for :id<int>, empty if any value matches
+	accept     func(string) bool
+}
+
+// parsePattern parses a :param style segment. Param names are made of letters, digits
+// and underscores, and may be followed by a constraint in angle brackets.
+func parsePattern(segment, fullPath string) *segmentPattern {
+	p := &segmentPattern{}
+	var shape strings.Builder
+	for i := 0; i < len(segment); {
+		if segment[i] != ':' {
+			end := strings.IndexByte(segment[i:], ':')
+			if end < 0 {
+				end = len(segment) - i
+			}
+			p.parts = append(p.parts, patternPart{literal: segment[i : i+end]})
+			shape.WriteString(segment[i : i+end])
+			i += end
+			continue
+		}
+
+		if len(p.parts) > 0 && p.parts[len(p.parts)-1].key != "" {
+			panic(fmt.Sprintf("params must be separated by a string literal in segment %s of path %s", segment, fullPath))
+		}
+		start := i + 1
+		for i = start; i < len(segment) && isParamNameByte(segment[i]); i++ {
+		}
+		if i == start {
+			panic(fmt.Sprintf("param name can not be empty in segment %s of path %s", segment, fullPath))
+		}
+		part := patternPart{key: segment[start:i]}
+		if i < len(segment) && segment[i] == '<' {
+			end := constraintEnd(segment[i:])
+			if end < 0 {
+				panic(fmt.Sprintf("unclosed constraint in segment %s of path %s", segment, fullPath))
+			}
+			part.constraint = segment[i+1 : i+end]
+			part.accept = compileConstraint(part.constraint, fullPath)
+			i += end + 1
+		}
+		p.parts = append(p.parts, part)
+		shape.WriteString(":<" + part.constraint + ">")
+	}
+	p.shape = shape.String()
+	return p
+}
+
+// constraintEnd returns the index of the '>' closing the constraint s starts with.
+func constraintEnd(s string) int {
+	depth := 0
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case '<':
+			depth++
+		case '>':
+			depth--
+			if depth == 0 {
+				return i
+			}
+		}
+	}
+	return -1
+}
+
+func isParamNameByte(c byte) bool {
+	return c == '_' || '0' <= c && c <= '9' || 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z'
+}
+
+// String returns the segment the pattern was parsed from.
+func (p *segmentPattern) String() string {
+	var b strings.Builder
+	for _, part := range p.parts {
+		if part.key == "" {
+			b.WriteString(part.literal)
+			continue
+		}
+		b.WriteString(":" + part.key)
+		if part.constraint != "" {
+			b.WriteString("<" + part.constraint + ">")
+		}
+	}
+	return b.String()
+}
+
+// isBare reports whether the pattern is a whole segment unconstrained :param.
+func (p *segmentPattern) isBare() bool {
+	return len(p.parts) == 1 && p.parts[0].key != "" && p.parts[0].accept == nil
+}
+
+// moreSpecific compares patterns by the length of their string literals, and then
+// by their number of constrained params.
+func (p *segmentPattern) moreSpecific(other *segmentPattern) bool {
+	literals, constraints := p.specificity()
+	otherLiterals, otherConstraints := other.specificity()
+	if literals != otherLiterals {
+		return literals > otherLiterals
+	}
+	return constraints > otherConstraints
+}
+
+func (p *segmentPattern) specificity() (literals, constraints int) {
+	for _, part := range p.parts {
+		literals += len(part.literal)
+		if part.accept != nil {
+			constraints++
+		}
+	}
+	return
+}
+
+func (p *segmentPattern) keys() []string {
+	keys := make([]string, 0, len(p.parts))
+	for _, part := range p.parts {
+		if part.key != "" {
+			keys = append(keys, part.key)
+		}
+	}
+	return keys
+}
+
+// match reports whether segment matches the pattern, appending the param values to params.
+// A param takes the shortest value followed by the next string literal, unless the
+// rest of the pattern then fails to match.
+func (p *segmentPattern) match(segment string, params *Params) bool {
+	if p.isBare() {
+		*params = append(*params, Param{p.parts[0].key, segment})
+		return true
+	}
+	mark := len(*params)
+	if matchParts(p.parts, segment, params) {
+		return true
+	}
+	*params = (*params)[:mark]
+	return false
+}
+
+func matchParts(parts []patternPart, s string, params *Params) bool {
+	if len(parts) == 0 {
+		return s == ""
+	}
+	part := parts[0]
+	if part.key == "" {
+		return strings.HasPrefix(s, part.literal) && matchParts(parts[1:], s[len(part.literal):], params)
+	}
+	if len(parts) == 1 {
+		if s == "" || part.accept != nil && !part.accept(s) {
+			return false
+		}
+		*params = append(*params, Param{part.key, s})
+		return true
+	}
+
+	next := parts[1].literal
+	for end := 1; end < len(s); end++ {
+		offset := strings.Index(s[end:], next)
+		if offset < 0 {
+			break
+		}
+		end += offset
+		if part.accept != nil && !part.accept(s[:end]) {
+			continue
+		}
+		*params = append(*params, Param{part.key, s[:end]})
+		if matchParts(parts[1:], s[end:], params) {
+			return true
+		}
+		*params = (*params)[:len(*params)-1]
+	}
+	return false
+}
+
+// paramTypes are the named constraints, any other constraint is a regular expression
+// the whole segment has to match.
+var paramTypes = map[string]func(string) bool{
+	"int":  isInt,
+	"uuid": isUUID,
+}
+
+func compileConstraint(constraint, fullPath string) func(string) bool {
+	if constraint == "" {
+		return nil
+	}
+	if match, ok := paramTypes[constraint]; ok {
+		return match
+	}
+	re, err := regexp.Compile("^(?:" + constraint + ")$")
+	if err != nil {
+		panic(fmt.Sprintf("invalid constraint %s in path %s: %v", constraint, fullPath, err))
+	}
+	return re.MatchString
+}
+
+func isInt(s string) bool {
+	if strings.HasPrefix(s, "-") {
+		s = s[1:]
+	}
+	if s == "" {
+		return false
+	}
+	for i := 0; i < len(s); i++ {
+		if s[i] < '0' || s[i] > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+func isUUID(s string) bool {
+	if len(s) != 36 {
+		return false
+	}
+	for i := 0; i < len(s); i++ {
+		switch {
+		case i == 8 || i == 13 || i == 18 || i == 23:
+			if s[i] != '-' {
+				return false
+			}
+		case '0' <= s[i] && s[i] <= '9', 'a' <= s[i] && s[i] <= 'f', 'A' <= s[i] && s[i] <= 'F':
+		default:
+			return false
+		}
+	}
+	return true
+}
+
 func isCatchAll(segment string) bool {
 	return strings.HasPrefix(segment, "*")
 }
 
 func isParam(segment string) bool {
-	return strings.HasPrefix(segment, ":")
+	return !isCatchAll(segment) && strings.IndexByte(segment, ':') >= 0
 }
 
 func isWild(segment string) bool {
@@ -0,0 +1,121 @@
+package yogin
+
+import (
+	"fmt"
+	"io"
+	"strings"
+)
+
+// PrintTree writes an indented view of the route trees to w, one tree per method. Each
+// node is listed with its segment, whether it has :param or *catchAll children, and for
+// the nodes of a route its number of handlers, or its versions, and full path.
+//     GET
+//     /  handlers=1  /
+//       users  wildChild
+//         new  handlers=1  /users/new
+//         :id<int>  handlers=2  /users/:id<int>
+// The trees of a Host are titled with the method followed by the host.
+func (engine *Engine) PrintTree(w io.Writer) {
+	engine.routes().eachTree(func(host string, tree methodTree) {
+		tree.print(w, host)
+	})
+}
+
+func (t methodTree) print(w io.Writer, host string) {
+	if host == "" {
+		fmt.Fprintln(w, t.method)
+	} else {
+		fmt.Fprintf(w, "%s %s\n", t.method, host)
+	}
+	t.root.print(w, 0)
+}
+
+func (n *node) print(w io.Writer, depth int) {
+	line := strings.Repeat("  ", depth) + n.label()
+	if len(n.wildChildren) > 0 || n.catchAllChild != nil {
+		line += "  wildChild"
+	}
+	if n.versions != nil {
+		line += fmt.Sprintf("  versions=%s  %s", strings.Join(sortedVersions(n.versions), ","), n.fullPath)
+	} else if n.handlers != nil {
+		line += fmt.Sprintf("  handlers=%d  %s", len(n.handlers), n.fullPath)
+	}
+	fmt.Fprintln(w, line)
+
+	for _, child := range n.children {
+		child.print(w, depth+1)
+	}
+	for _, child := range n.wildChildren {
+		child.print(w, depth+1)
+	}
+	if n.catchAllChild != nil {
+		n.catchAllChild.print(w, depth+1)
+	}
+}
+
+// PrintDOT writes the route trees to w in the Graphviz DOT language, with one cluster per
+// method tree, e.g. to render them with: dot -Tsvg routes.dot -o routes.svg
+// The nodes of a route are drawn with a double border, and :param or *catchAll nodes
+// with a dashed one.
+func (engine *Engine) PrintDOT(w io.Writer) {
+	fmt.Fprintln(w, "digraph routes {")
+	fmt.Fprintln(w, "\tnode [shape=box];")
+	ids := 0
+	engine.routes().eachTree(func(host string, tree methodTree) {
+		label := tree.method
+		if host != "" {
+			label += " " + host
+		}
+		fmt.Fprintf(w, "\tsubgraph cluster_%d {\n", ids)
+		fmt.Fprintf(w, "\t\tlabel=%s;\n", dotQuote(label))
+		tree.root.printDOT(w, &ids, -1)
+		fmt.Fprintln(w, "\t}")
+	})
+	fmt.Fprintln(w, "}")
+}
+
+func (n *node) printDOT(w io.Writer, ids *int, parent int) {
+	id := *ids
+	*ids++
+
+	label, attrs := n.label(), ""
+	if n.versions != nil {
+		label += fmt.Sprintf("\n%s\nversions %s", n.fullPath, strings.Join(sortedVersions(n.versions), ", "))
+	} else if n.handlers != nil {
+		label += fmt.Sprintf("\n%s\n%d handlers", n.fullPath, len(n.handlers))
+	}
+	if n.handlers != nil {
+		attrs += ", peripheries=2"
+	}
+	if n.pattern != nil || isCatchAll(n.segment) {
+		attrs += ", style=dashed"
+	}
+	fmt.Fprintf(w, "\t\tn%d [label=%s%s];\n", id, dotQuote(label), attrs)
+	if parent >= 0 {
+		fmt.Fprintf(w, "\t\tn%d -> n%d;\n", parent, id)
+	}
+
+	for _, child := range n.children {
+		child.printDOT(w, ids, id)
+	}
+	for _, child := range n.wildChildren {
+		child.printDOT(w, ids, id)
+	}
+	if n.catchAllChild != nil {
+		n.catchAllChild.printDOT(w, ids, id)
+	}
+}
+
+// label returns the segment of n, or / for the root.
+func (n *node) label() string {
+	if n.segment == "" {
+		return "/"
+	}
+	return n.segment
+}
+
+var dotEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func dotQuote(s string) string {
+	return `"` + dotEscaper.Replace(s) + `"`
+}
@@ -1,7 +1,101 @@
 package yogin
 
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"net/http"
+	"reflect"
+	"runtime"
+	"strings"
+)
+
+// WrapF is a helper function for wrapping http.HandlerFunc and returns a yogin middleware.
+func WrapF(f http.HandlerFunc) HandlerFunc {
+	return WrapH(f)
+}
+
+// WrapH is a helper function for wrapping http.Handler and returns a yogin middleware.
+// The status code and body size written by the handler are recorded in the Context,
+// so that e.g. the Logger reports them.
+func WrapH(h http.Handler) HandlerFunc {
+	return func(c *Context) {
+		h.ServeHTTP(&contextWriter{ResponseWriter: c.Writer, c: c}, c.Request)
+	}
+}
+
+// contextWriter records the response of a wrapped http.Handler in its Context.
+type contextWriter struct {
+	http.ResponseWriter
+	c *Context
+}
+
+func (w *contextWriter) WriteHeader(code int) {
+	if w.c.statusCode == 0 {
+		w.c.statusCode = code
+	}
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *contextWriter) Write(data []byte) (int, error) {
+	if w.c.statusCode == 0 {
+		w.c.statusCode = http.StatusOK
+	}
+	n, err := w.ResponseWriter.Write(data)
+	w.c.bodySize += n
+	return n, err
+}
+
+// Flush implements the http.Flusher interface, e.g. for server-sent events.
+func (w *contextWriter) Flush() {
+	if flusher, ok := w.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// Hijack implements the http.Hijacker interface, e.g. for websockets.
+func (w *contextWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	return hijack(w.ResponseWriter)
+}
+
+// hijack takes over the connection of w for the writers wrapping it.
+func hijack(w http.ResponseWriter) (net.Conn, *bufio.ReadWriter, error) {
+	hijacker, ok := w.(http.Hijacker)
+	if !ok {
+		return nil, nil, fmt.Errorf("the ResponseWriter doesn't support the Hijacker interface")
+	}
+	return hijacker.Hijack()
+}
+
 func assert1(guard bool, text string) {
 	if !guard {
 		panic(text)
 	}
 }
+
+func nameOfFunction(f interface{}) string {
+	return runtime.FuncForPC(reflect.ValueOf(f).Pointer()).Name()
+}
+
+// isToken reports whether s is a token as defined by RFC 7230, e.g. a valid HTTP method.
+func isToken(s string) bool {
+	if s == "" {
+		return false
+	}
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if !('0' <= c && c <= '9' || 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' || strings.IndexByte("!#$%&'*+-.^_`|~", c) >= 0) {
+			return false
+		}
+	}
+	return true
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,112 @@
+package yogin
+
+import (
+	"net/http"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// Version returns a RouterGroup whose routes are only served to the requests for the
+// given API version, so that the routes of several versions can share their paths.
+// The version is requested with the Api-Version header, or with a vendor media type of
+// the Accept header such as application/vnd.acme.v2+json, and defaults to
+// Engine.DefaultVersion. Requests for a version without a route for the path are
+// answered with 406 Not Acceptable.
+//     router.Version("1").GET("/users", listUsersV1)
+//     router.Version("2").GET("/users", listUsersV2)
+// Replace and Remove only affect the routes of the group's version.
+func (group *RouterGroup) Version(version string, handlers ...HandlerFunc) *RouterGroup {
+	version = normalizeVersion(version)
+	assert1(version != "", "version can not be empty")
+	return &RouterGroup{
+		Handlers: group.combineHandlers(handlers),
+		basePath: group.basePath,
+		engine:   group.engine,
+		host:     group.host,
+		version:  version,
+	}
+}
+
+// vendorMediaType matches the subtype of vendor media types such as vnd.acme.v2+json.
+var vendorMediaType = regexp.MustCompile(`^vnd\.[^+]+\.v([0-9]+(?:\.[0-9]+)*)(?:\+.*)?$`)
+
+// requestVersion returns the API version of the request, see RouterGroup.Version.
+func (engine *Engine) requestVersion(req *http.Request) string {
+	if version := normalizeVersion(req.Header.Get("Api-Version")); version != "" {
+		return version
+	}
+	for _, accept := range strings.Split(req.Header.Get("Accept"), ",") {
+		mediaType := strings.TrimSpace(strings.SplitN(accept, ";", 2)[0])
+		slash := strings.IndexByte(mediaType, '/')
+		if slash < 0 {
+			continue
+		}
+		if m := vendorMediaType.FindStringSubmatch(strings.ToLower(mediaType[slash+1:])); m != nil {
+			return m[1]
+		}
+	}
+	return normalizeVersion(engine.DefaultVersion)
+}
+
+// normalizeVersion makes e.g. v2 and 2 the same version.
+func normalizeVersion(version string) string {
+	return strings.TrimPrefix(strings.ToLower(strings.TrimSpace(version)), "v")
+}
+
+// versionHandler is the only handler of the nodes of versioned routes. It runs the
+// handlers of the requested version instead, or answers with 406.
+func versionHandler(versions map[string]HandlersChain) HandlerFunc {
+	return func(c *Context) {
+		c.Writer.Header().Add("Vary", "Accept, Api-Version")
+		handlers, ok := versions[c.engine.requestVersion(c.Request)]
+		if !ok {
+			handlers = c.engine.combineHandlers(HandlersChain{notAcceptableHandler})
+		}
+		c.handlers = handlers
+		c.index = -1
+		c.Next()
+	}
+}
+
+var notAcceptableHandler = func(c *Context) {
+	if c.statusCode == 0 {
+		c.String(http.StatusNotAcceptable, "no version of url %v is acceptable", c.Path)
+	}
+}
+
+// withVersion returns a copy of versions with the handlers of version.
+func withVersion(versions map[string]HandlersChain, version string, handlers HandlersChain) map[string]HandlersChain {
+	c := make(map[string]HandlersChain, len(versions)+1)
+	for v, h := range versions {
+		c[v] = h
+	}
+	c[version] = handlers
+	return c
+}
+
+// withoutVersion returns a copy of versions without the handlers of version.
+func withoutVersion(versions map[string]HandlersChain, version string) map[string]HandlersChain {
+	c := make(map[string]HandlersChain, len(versions))
+	for v, h := range versions {
+		if v != version {
+			c[v] = h
+		}
+	}
+	return c
+}
+
+// sortedVersions returns the versions in ascending order, comparing numbers numerically.
+func sortedVersions(versions map[string]HandlersChain) []string {
+	sorted := make([]string, 0, len(versions))
+	for version := range versions {
+		sorted = append(sorted, version)
+	}
+	sort.Slice(sorted, func(i, j int) bool {
+		if len(sorted[i]) != len(sorted[j]) && isInt(sorted[i]) && isInt(sorted[j]) {
+			return len(sorted[i]) < len(sorted[j])
+		}
+		return sorted[i] < sorted[j]
+	})
+	return sorted
+}
@@ -1,76 +1,636 @@
+// Package yogin is a web framework built after gin, with a radix tree router, route
+// groups and middlewares.
 package yogin
 
 import (
+	"bufio"
+	"context"
+	"fmt"
 	"html/template"
+	"net"
 	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
 	"sync"
+	"sync/atomic"
+	"time"
 )
 
 type HandlersChain []HandlerFunc
 type HandlerFunc func(*Context)
 type H map[string]interface{}
 
+// Last returns the last handler in the chain. i.e. the last handler is the main one.
+func (c HandlersChain) Last() HandlerFunc {
+	if length := len(c); length > 0 {
+		return c[length-1]
+	}
+	return nil
+}
+
+// RouteInfo represents a request route's specification which contains method and path and its handler.
+type RouteInfo struct {
+	Host        string // host pattern, empty for the default host
+	Version     string // empty for the routes of all versions
+	Method      string
+	Path        string
+	Handler     string // name of the main handler function
+	HandlerFunc HandlerFunc
+	Middlewares int // number of handlers run before the main one
+}
+
+// RoutesInfo defines a RouteInfo slice.
+type RoutesInfo []RouteInfo
+
+var optionsHandler = func(c *Context) {
+	if c.statusCode == 0 {
+		c.Status(http.StatusNoContent)
+	}
+}
+
+// notFoundHandler and methodNotAllowedHandler are appended to the NoRoute and NoMethod
+// chains. They only write the default response if none of the user handlers has written one.
 var notFoundHandler = func(c *Context) {
-	c.String(http.StatusNotFound, "url %v not found", c.Path)
+	if c.statusCode == 0 {
+		c.String(http.StatusNotFound, "url %v not found", c.Path)
+	}
+}
+
+var methodNotAllowedHandler = func(c *Context) {
+	if c.statusCode == 0 {
+		c.String(http.StatusMethodNotAllowed, "method %v not allowed for url %v", c.Method, c.Path)
+	}
+}
+
+// groupNoRoute is the NoRoute chain of a RouterGroup, used for unmatched paths under prefix.
+type groupNoRoute struct {
+	host     string
+	prefix   string
+	handlers HandlersChain
 }
 
 type Engine struct {
 	RouterGroup
-	methodTrees map[string]methodTree
+	routeTable  atomic.Value // *routeTable, see routes
+	routesMu    sync.Mutex   // serializes the route table updates
 	contextPool	sync.Pool
 
+	// HandleMethodNotAllowed if enabled, the router checks if another method is allowed for the
+	// current route, if the current request can not be routed.
+	// If this is the case, the request is answered with 'Method Not Allowed'
+	// and HTTP status code 405, along with an Allow header listing the registered methods.
+	// If no other Method is allowed, the request is delegated to the NotFound handler.
+	HandleMethodNotAllowed bool
+
+	// HandleOPTIONS if enabled, the router automatically replies to OPTIONS requests
+	// with 204 and an Allow header listing the methods registered for the path,
+	// unless an OPTIONS route is registered for it. OPTIONS * lists all the methods.
+	// Global middleware attached with Use still runs, e.g. to add CORS headers.
+	HandleOPTIONS bool
+
+	// RedirectTrailingSlash enables automatic redirection if the current route can't be matched
+	// literally but a handler for the path with (without) the trailing slash exists.
+	// For example if /foo/ is requested but a route only exists for /foo, the
+	// client is redirected to /foo with http status code 301 for GET requests
+	// and 308 for all other request methods.
+	RedirectTrailingSlash bool
+
+	// RedirectFixedPath if enabled, the router tries to fix the current request path, if no
+	// handle is registered for it, or if it is not in its canonical form.
+	// First superfluous path elements like ../ or // are removed.
+	// Afterwards the router does a case-insensitive lookup of the cleaned path.
+	// If a handle can be found for this route, the router makes a redirection
+	// to the corrected path with status code 301 for GET requests and 308 for
+	// all other request methods.
+	// For example /FOO and /..//Foo could be redirected to /foo.
+	// RedirectTrailingSlash is independent of this option.
+	RedirectFixedPath bool
+
+	// UseRawPath if enabled, the url.RawPath will be used to find parameters.
+	// net/url only sets it when the escaped path can not be recovered from url.Path,
+	// e.g. /files/a%2Fb, which then matches /files/:name instead of /files/a/b.
+	UseRawPath bool
+
+	// UnescapePathValues if true, the path values will be unescaped.
+	// If UseRawPath is false (by default), the UnescapePathValues effectively is true,
+	// as url.Path gonna be used, which is already unescaped.
+	UnescapePathValues bool
+
+	// CaseInsensitive if enabled, the string literal segments of the routes match the
+	// request path regardless of case, e.g. /Users/Profile matches /users/profile, while
+	// the values of params keep the case of the request. Literals that match exactly are
+	// still preferred, so that requests in the registered case are looked up as fast.
+	// Unlike RedirectFixedPath, the request is served without redirection.
+	CaseInsensitive bool
+
+	// DefaultVersion is the API version of the requests that do not specify one,
+	// see RouterGroup.Version.
+	DefaultVersion string
+
+	noRoute       HandlersChain
+	allNoRoute    HandlersChain
+	groupNoRoutes []groupNoRoute // sorted by descending prefix length
+	noMethod      HandlersChain
+	allNoMethod   HandlersChain
+
 	htmlTemplates *template.Template // for html render
 	FuncMap       template.FuncMap   // for html render
+
+	// ShutdownTimeout is how long the Run methods wait for the in-flight requests to
+	// finish when they are stopped, see RunWithContext.
+	ShutdownTimeout time.Duration
+
+	// UnixSocketMode are the permissions of the socket created by RunUnix, e.g. 0660 to
+	// let the group of the proxy connect to it. If zero, they depend on the umask.
+	// It is ignored on the platforms other than Unix.
+	UnixSocketMode os.FileMode
+
+	// RemoteIPHeaders are the headers in which the trusted proxies report the client IP,
+	// tried in order, see SetTrustedProxies. Besides lists like X-Forwarded-For and
+	// single IPs like X-Real-IP, the RFC 7239 Forwarded header is supported.
+	// The default ones are X-Forwarded-For and X-Real-IP.
+	RemoteIPHeaders []string
+	trustedProxies  trustedNets
+	proxyUpstreams  *trustedNets // see UseProxyProtocol
+
+	// GracefulRestart if enabled, the Run methods restart the engine on SIGUSR2 or SIGHUP
+	// without dropping any connection: a new process takes over the listening sockets,
+	// and the engine is drained once it is ready, see Restart. It is ignored on the
+	// platforms other than Unix.
+	// The first Run of such an engine takes over the listening sockets the process
+	// inherited from Restart, or from systemd socket activation through LISTEN_PID and
+	// LISTEN_FDS, and the Run methods serve the one bound to their address. Until then,
+	// the inherited sockets and variables are left to the application.
+	GracefulRestart bool
+
+	serversMu  sync.Mutex
+	servers    map[*http.Server]net.Listener // started by the Run methods
+	shutdown   *shutdown                     // the last one, see Shutdown
+	start      *startup                      // of the servers, see OnStart
+	onStart    []func() error
+	onShutdown []func(ctx context.Context) error
+	restartMu  sync.Mutex
+	restarted  bool
 }
 
 func (engine *Engine) addRoute(method, path string, handlers HandlersChain) {
-	if _, ok := engine.methodTrees[method]; !ok {
-		engine.methodTrees[method] = methodTree{method, &node{path: "/"}}
+	engine.addHostRoute("", "", method, path, handlers, false)
+}
+
+// addHostRoute adds the route to the trees of host, or of the default host if host is empty,
+// for the given version, or for all versions if version is empty.
+// If replace is true, the route registered with the same path and version is removed first.
+func (engine *Engine) addHostRoute(host, version, method, path string, handlers HandlersChain, replace bool) {
+	engine.updateRoutes(func(table *routeTable) {
+		if replace {
+			table.removeRoute(host, version, method, path)
+		}
+		table.addRoute(host, version, method, path, handlers)
+	})
+}
+
+// removeHostRoute removes the route from the trees of host, and reports whether it was registered.
+func (engine *Engine) removeHostRoute(host, version, method, path string) (removed bool) {
+	engine.updateRoutes(func(table *routeTable) {
+		removed = table.removeRoute(host, version, method, path)
+	})
+	return removed
+}
+
+// Routes returns a slice of registered routes, including some useful information, such as:
+// the http method, path, handler name and number of middlewares.
+// The routes of the default host come first, then the ones of each Host in matching
+// order. Methods are listed in alphabetical order, and the routes of a method in tree order.
+func (engine *Engine) Routes() (routes RoutesInfo) {
+	engine.routes().eachTree(func(host string, tree methodTree) {
+		routes = iterate(host, tree.method, routes, tree.root)
+	})
+	return routes
+}
+
+func iterate(host, method string, routes RoutesInfo, root *node) RoutesInfo {
+	if root.handlers != nil && !root.shortened {
+		if root.versions == nil {
+			routes = append(routes, routeInfo(host, "", method, root.fullPath, root.handlers))
+		}
+		for _, version := range sortedVersions(root.versions) {
+			routes = append(routes, routeInfo(host, version, method, root.fullPath, root.versions[version]))
+		}
+	}
+	for _, child := range root.children {
+		routes = iterate(host, method, routes, child)
 	}
-	tree := engine.methodTrees[method]
-	tree.addRoute(path, handlers)
+	for _, child := range root.wildChildren {
+		routes = iterate(host, method, routes, child)
+	}
+	if root.catchAllChild != nil {
+		routes = iterate(host, method, routes, root.catchAllChild)
+	}
+	return routes
+}
+
+func routeInfo(host, version, method, path string, handlers HandlersChain) RouteInfo {
+	handlerFunc := handlers.Last()
+	return RouteInfo{
+		Host:        host,
+		Version:     version,
+		Method:      method,
+		Path:        path,
+		Handler:     nameOfFunction(handlerFunc),
+		HandlerFunc: handlerFunc,
+		Middlewares: len(handlers) - 1,
+	}
+}
+
+func (engine *Engine) addNamedRoute(name, path string) {
+	assert1(name != "", "route name can not be empty")
+	engine.updateRoutes(func(table *routeTable) {
+		if existing, ok := table.names[name]; ok && existing != path {
+			panic(fmt.Sprintf("route name %s of %s is already used by %s", name, path, existing))
+		}
+		table.names[name] = path
+	})
+}
+
+// URL builds the URL of the named route, filling its :param and *catchAll segments
+// from the key/value pairs in params. Pairs whose key is not a segment of the route
+// are added to the query string.
+//     router.GET("/users/:id", handler).Name("user")
+//     router.URL("user", "id", 42, "tab", "posts") // "/users/42?tab=posts"
+func (engine *Engine) URL(name string, params ...interface{}) (string, error) {
+	fullPath, ok := engine.routes().names[name]
+	if !ok {
+		return "", fmt.Errorf("route %s not found", name)
+	}
+	if len(params)%2 != 0 {
+		return "", fmt.Errorf("odd number of params for route %s", name)
+	}
+	values := make(map[string]string, len(params)/2)
+	keys := make([]string, 0, len(params)/2)
+	for i := 0; i < len(params); i += 2 {
+		key := fmt.Sprint(params[i])
+		values[key] = fmt.Sprint(params[i+1])
+		keys = append(keys, key)
+	}
+
+	var b strings.Builder
+	omitted := ""
+	for _, segment := range parseSegments(fullPath) {
+		if isOptionalParam(segment) {
+			param := parseOptionalParam(segment, fullPath)
+			if _, ok := values[param.key]; !ok {
+				omitted = param.key
+				continue
+			}
+			if omitted != "" {
+				return "", fmt.Errorf("missing param %s before %s for route %s", omitted, param.key, name)
+			}
+			segment = param.segment
+		}
+
+		b.WriteByte('/')
+		switch {
+		case isCatchAll(segment):
+			value := values[segment[1:]]
+			delete(values, segment[1:])
+			for i, part := range strings.Split(strings.Trim(value, "/"), "/") {
+				if i > 0 {
+					b.WriteByte('/')
+				}
+				b.WriteString(url.PathEscape(part))
+			}
+		case isParam(segment):
+			for _, part := range parsePattern(segment, fullPath).parts {
+				if part.key == "" {
+					b.WriteString(part.literal)
+					continue
+				}
+				value, ok := values[part.key]
+				if !ok {
+					return "", fmt.Errorf("missing param %s for route %s", part.key, name)
+				}
+				if part.accept != nil && !part.accept(value) {
+					return "", fmt.Errorf("param %s of route %s does not satisfy <%s>: %s", part.key, name, part.constraint, value)
+				}
+				delete(values, part.key)
+				b.WriteString(url.PathEscape(value))
+			}
+		default:
+			b.WriteString(segment)
+		}
+	}
+	if b.Len() == 0 || strings.HasSuffix(fullPath, "/") && omitted == "" {
+		b.WriteByte('/')
+	}
+
+	query := url.Values{}
+	for _, key := range keys {
+		if value, ok := values[key]; ok {
+			query.Add(key, value)
+		}
+	}
+	if len(query) > 0 {
+		b.WriteByte('?')
+		b.WriteString(query.Encode())
+	}
+	return b.String(), nil
 }
 
 func (engine *Engine) allocateContext() *Context {
-	v := make(Params, 0, 4)
+	v := make(Params, 0, engine.routes().maxParams)
 	return &Context{Params: v, engine: engine}
 }
 
+// Use attaches a global middleware to the router. The middleware is also
+// included in the handlers chain of 404 and 405 responses.
+func (engine *Engine) Use(middleware ...HandlerFunc) {
+	engine.RouterGroup.Use(middleware...)
+	engine.rebuild404Handlers()
+	engine.rebuild405Handlers()
+}
+
+// NoRoute sets the handlers called when no route matches the request.
+// Global middleware attached with Use runs before them.
+func (engine *Engine) NoRoute(handlers ...HandlerFunc) {
+	engine.noRoute = handlers
+	engine.rebuild404Handlers()
+}
+
+// NoMethod sets the handlers called when the path is registered under another method
+// and HandleMethodNotAllowed is enabled. The Allow header is already set when they run.
+func (engine *Engine) NoMethod(handlers ...HandlerFunc) {
+	engine.noMethod = handlers
+	engine.rebuild405Handlers()
+}
+
+func (engine *Engine) rebuild404Handlers() {
+	engine.allNoRoute = append(engine.combineHandlers(engine.noRoute), notFoundHandler)
+}
+
+func (engine *Engine) addGroupNoRoute(host, prefix string, handlers HandlersChain) {
+	for i := range engine.groupNoRoutes {
+		if engine.groupNoRoutes[i].host == host && engine.groupNoRoutes[i].prefix == prefix {
+			engine.groupNoRoutes[i].handlers = handlers
+			return
+		}
+	}
+	engine.groupNoRoutes = append(engine.groupNoRoutes, groupNoRoute{host, prefix, handlers})
+	sort.SliceStable(engine.groupNoRoutes, func(i, j int) bool {
+		return len(engine.groupNoRoutes[i].prefix) > len(engine.groupNoRoutes[j].prefix)
+	})
+}
+
+// noRouteHandlers returns the NoRoute chain of the innermost group of host whose base
+// path contains path, falling back to the engine's one.
+func (engine *Engine) noRouteHandlers(host, path string) HandlersChain {
+	for _, entry := range engine.groupNoRoutes {
+		if entry.host != host {
+			continue
+		}
+		if path == entry.prefix || strings.HasPrefix(path, strings.TrimSuffix(entry.prefix, "/")+"/") {
+			return entry.handlers
+		}
+	}
+	return engine.allNoRoute
+}
+
+func (engine *Engine) rebuild405Handlers() {
+	engine.allNoMethod = append(engine.combineHandlers(engine.noMethod), methodNotAllowedHandler)
+}
+
+// allowedMethods returns the sorted methods whose trees have a route for path,
+// including the ones served implicitly: HEAD if GET is registered, and OPTIONS
+// if HandleOPTIONS is enabled. The params of the lookups are appended to params and
+// dropped again.
+func (engine *Engine) allowedMethods(trees methodTrees, path string, params *Params) []string {
+	allowed := make([]string, 0)
+	mark := len(*params)
+	for method, tree := range trees {
+		if path == "*" {
+			allowed = append(allowed, method)
+			continue
+		}
+		if value := tree.getRoute(path, params, engine.CaseInsensitive); value.handlers != nil {
+			allowed = append(allowed, method)
+		}
+		*params = (*params)[:mark]
+	}
+	if len(allowed) == 0 {
+		return allowed
+	}
+
+	implicit := make([]string, 0, 2)
+	if contains(allowed, http.MethodGet) {
+		implicit = append(implicit, http.MethodHead)
+	}
+	if engine.HandleOPTIONS {
+		implicit = append(implicit, http.MethodOptions)
+	}
+	for _, method := range implicit {
+		if !contains(allowed, method) {
+			allowed = append(allowed, method)
+		}
+	}
+	sort.Strings(allowed)
+	return allowed
+}
+
 // ServeHTTP conforms to the http.Handler interface.
 func (engine *Engine) ServeHTTP(w http.ResponseWriter, req *http.Request) {
-	method := req.Method
-	path := req.URL.Path
 	c := engine.contextPool.Get().(*Context)
 	c.reset(w, req)
 
-	if _, ok := engine.methodTrees[method]; !ok {
-		c.handlers = engine.RouterGroup.combineHandlers(HandlersChain{notFoundHandler})
-		c.Next()
-		return
+	engine.handleHTTPRequest(c)
+
+	engine.contextPool.Put(c)
+}
+
+func (engine *Engine) handleHTTPRequest(c *Context) {
+	method := c.Request.Method
+	path := c.Request.URL.Path
+	unescape := false
+	if engine.UseRawPath && len(c.Request.URL.RawPath) > 0 {
+		path = c.Request.URL.RawPath
+		unescape = engine.UnescapePathValues
 	}
-	tree := engine.methodTrees[method]
 
-	value := tree.getRoute(path)
-	if value.handlers == nil {
-		c.handlers = engine.RouterGroup.combineHandlers(HandlersChain{notFoundHandler})
-		c.Next()
-		return
+	table := engine.routes()
+	trees, host := table.trees, ""
+	if router := table.matchHost(c.Request.Host, &c.Params); router != nil {
+		trees, host = router.trees, router.host
+	}
+
+	if tree, ok := trees[method]; ok {
+		if engine.serveRoute(c, tree, path, unescape) {
+			return
+		}
+	}
+
+	// serve HEAD with the GET handlers, discarding the body
+	if method == http.MethodHead {
+		if tree, ok := trees[http.MethodGet]; ok {
+			writer := &headResponseWriter{ResponseWriter: c.Writer}
+			c.Writer = writer
+			if engine.serveRoute(c, tree, path, unescape) {
+				writer.flush()
+				return
+			}
+			c.Writer = writer.ResponseWriter
+		}
 	}
 
-	c.handlers = value.handlers
-	c.Params = value.params
-	c.FullPath = value.fullPath
+	if method == http.MethodOptions && engine.HandleOPTIONS {
+		if allowed := engine.allowedMethods(trees, path, &c.Params); len(allowed) > 0 {
+			c.Header("Allow", strings.Join(allowed, ", "))
+			c.handlers = engine.combineHandlers(HandlersChain{optionsHandler})
+			c.Next()
+			return
+		}
+	}
+
+	if engine.HandleMethodNotAllowed {
+		if allowed := engine.allowedMethods(trees, path, &c.Params); len(allowed) > 0 {
+			c.Header("Allow", strings.Join(allowed, ", "))
+			c.handlers = engine.allNoMethod
+			c.Next()
+			return
+		}
+	}
+
+	c.handlers = engine.noRouteHandlers(host, path)
 	c.Next()
+}
 
-	engine.contextPool.Put(c)
+// serveRoute looks up path in tree and, if it matches, serves the request or redirects
+// it to the canonical path. If unescape is true, the params found in path are unescaped.
+func (engine *Engine) serveRoute(c *Context, tree methodTree, path string, unescape bool) bool {
+	mark := len(c.Params)
+	value := tree.getRoute(path, &c.Params, engine.CaseInsensitive)
+	if value.handlers != nil {
+		if unescape {
+			unescapeParams(c.Params[mark:])
+		}
+		if engine.RedirectTrailingSlash || engine.RedirectFixedPath {
+			if location, ok := engine.redirectLocation(path, canonicalPath(path, value.fullPath)); ok {
+				engine.redirectRequest(c, location)
+				return true
+			}
+		}
+		c.handlers = value.handlers
+		c.FullPath = value.fullPath
+		c.Next()
+		return true
+	}
+	if c.Request.Method != http.MethodConnect && engine.RedirectFixedPath {
+		if fixedPath, ok := tree.findCaseInsensitivePath(path); ok {
+			if location, ok := engine.redirectLocation(path, fixedPath); ok {
+				engine.redirectRequest(c, location)
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// unescapeParams decodes the percent-encoded values of params in place. Invalid escapes
+// are left as is.
+func unescapeParams(params Params) {
+	for i := range params {
+		if value, err := url.PathUnescape(params[i].Value); err == nil {
+			params[i].Value = value
+		}
+	}
+}
+
+// headResponseWriter discards the body written by the GET handlers serving a HEAD
+// request, and sets the Content-Length the body would have had.
+type headResponseWriter struct {
+	http.ResponseWriter
+	status int
+	size   int
+}
+
+func (w *headResponseWriter) WriteHeader(code int) {
+	if w.status == 0 {
+		w.status = code
+	}
+}
+
+func (w *headResponseWriter) Write(data []byte) (int, error) {
+	w.size += len(data)
+	return len(data), nil
+}
+
+// Flush implements the http.Flusher interface. Nothing is flushed, as the headers are
+// only written once the handlers returned, with the Content-Length of the body.
+func (w *headResponseWriter) Flush() {}
+
+// Hijack implements the http.Hijacker interface, see contextWriter.
+func (w *headResponseWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	return hijack(w.ResponseWriter)
+}
+
+func (w *headResponseWriter) flush() {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	header := w.Header()
+	if header.Get("Content-Length") == "" && w.status != http.StatusNoContent && w.status != http.StatusNotModified {
+		header.Set("Content-Length", strconv.Itoa(w.size))
+	}
+	w.ResponseWriter.WriteHeader(w.status)
+}
+
+// redirectLocation decides whether a request for path should be redirected to the
+// canonical path of the route it matches, according to RedirectTrailingSlash and
+// RedirectFixedPath.
+func (engine *Engine) redirectLocation(path, canonical string) (string, bool) {
+	if !engine.RedirectTrailingSlash {
+		// keep the trailing slash state of the request
+		if strings.HasSuffix(path, "/") && canonical != "/" && !strings.HasSuffix(canonical, "/") {
+			canonical += "/"
+		} else if !strings.HasSuffix(path, "/") && canonical != "/" {
+			canonical = strings.TrimSuffix(canonical, "/")
+		}
+	}
+	if canonical == path {
+		return "", false
+	}
+	if strings.TrimSuffix(path, "/") == strings.TrimSuffix(canonical, "/") {
+		return canonical, engine.RedirectTrailingSlash
+	}
+	return canonical, engine.RedirectFixedPath
+}
+
+// redirectRequest answers with 301 for GET requests and 308 for all other methods,
+// so that the method and body are preserved. The location is escaped unless it was
+// found from the raw path, so that the segments of the request stay in the path.
+func (engine *Engine) redirectRequest(c *Context, location string) {
+	code := http.StatusMovedPermanently
+	if c.Request.Method != http.MethodGet {
+		code = http.StatusPermanentRedirect
+	}
+	if !engine.UseRawPath || len(c.Request.URL.RawPath) == 0 {
+		location = (&url.URL{Path: location}).EscapedPath()
+	}
+	if c.Request.URL.RawQuery != "" {
+		location += "?" + c.Request.URL.RawQuery
+	}
+	c.handlers = engine.combineHandlers(HandlersChain{func(c *Context) {
+		c.Redirect(code, location)
+	}})
+	c.Next()
 }
 
 // Run attaches the router to a http.Server and starts listening and serving HTTP requests.
-// It is a shortcut for http.ListenAndServe(addr, router)
+// It is a shortcut for RunWithContext(context.Background(), addr), so that it returns
+// once the engine is shut down, see Shutdown.
 // Note: this method will block the calling goroutine indefinitely unless an error happens.
 func (engine *Engine) Run(addr string) (err error) {
-	err = http.ListenAndServe(addr, engine)
-	return
+	return engine.RunWithContext(context.Background(), addr)
 }
 
 func New() *Engine {
@@ -80,9 +640,18 @@ func New() *Engine {
 			basePath: "/",
 			root:     true,
 		},
-		methodTrees: make(map[string]methodTree),
+		HandleMethodNotAllowed: true,
+		HandleOPTIONS:          true,
+		UnescapePathValues:     true,
+		ShutdownTimeout:        10 * time.Second,
+		RemoteIPHeaders:        append([]string(nil), defaultRemoteIPHeaders...),
+		servers:                make(map[*http.Server]net.Listener),
 	}
 	engine.RouterGroup.engine = engine
+	engine.routeTable.Store(newRouteTable())
+	engine.FuncMap = engine.defaultFuncMap()
+	engine.rebuild404Handlers()
+	engine.rebuild405Handlers()
 	engine.contextPool.New = func() interface{} {
 		return engine.allocateContext()
 	}
@@ -95,11 +664,23 @@ func Default() *Engine {
 	return engine
 }
 
+// LoadHTMLGlob loads the templates matching pattern. Besides the functions of FuncMap,
+// the templates can use the default ones, e.g. {{ urlFor "user" "id" .ID }}.
 func (engine *Engine) LoadHTMLGlob(pattern string) {
-	engine.htmlTemplates = template.Must(template.New("").Funcs(engine.FuncMap).ParseGlob(pattern))
+	funcMap := engine.defaultFuncMap()
+	for name, fn := range engine.FuncMap {
+		funcMap[name] = fn
+	}
+	engine.htmlTemplates = template.Must(template.New("").Funcs(funcMap).ParseGlob(pattern))
 }
 
 // SetFuncMap sets the FuncMap used for template.FuncMap.
 func (engine *Engine) SetFuncMap(funcMap template.FuncMap) {
 	engine.FuncMap = funcMap
 }
+
+func (engine *Engine) defaultFuncMap() template.FuncMap {
+	return template.FuncMap{
+		"urlFor": engine.URL,
+	}
+}